@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/spf13/cobra"
+)
+
+var actionWorkers int
+
+// errNotStarted is the error of the calls runParallel didn't make because an
+// earlier one failed.
+var errNotStarted = errors.New("not started since an earlier file failed")
+
+// runParallel calls do with each index below n on actionWorkers goroutines,
+// handing out the indexes in order until ctx is done or, without
+// --skip-errors, a call fails. It returns the error of each call, the calls
+// never made get ctx's error or errNotStarted.
+func runParallel(ctx context.Context, n int, do func(i int) error) []error {
+	errs := make([]error, n)
+	indexes := make(chan int)
+	failed := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, actionWorkers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = do(i)
+				if errs[i] != nil && !skipErrors {
+					once.Do(func() { close(failed) })
+				}
+			}
+		}()
+	}
+
+	next := 0
+feed:
+	for ; next < n; next++ {
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break feed
+		case <-failed:
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := next; i < n; i++ {
+		errs[i] = ctx.Err()
+		if errs[i] == nil {
+			errs[i] = errNotStarted
+		}
+	}
+	return errs
+}
+
+// actionFailures returns the files whose action failed along with their
+// errors, to be listed at the end with --skip-errors. Without it the first
+// failure is returned as the error instead.
+func actionFailures(cmd *cobra.Command, files []dedup.PathTime, errs []error) ([]dedup.FileError, error) {
+	failures := make([]dedup.FileError, 0)
+	for i, err := range errs {
+		if err == nil || errors.Is(err, errNotStarted) {
+			continue
+		}
+		if !skipErrors {
+			cmd.SilenceUsage = true
+			return nil, ioError{err}
+		}
+		failures = append(failures, dedup.FileError{Path: files[i].Path, Err: err})
+	}
+	return failures, nil
+}
+
+// printFailures prints the files that couldn't be copied, moved, removed or
+// linked to stderr.
+func printFailures(failures []dedup.FileError) {
+	if len(failures) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Couldn't change %v files:\n", formatCount(len(failures)))
+	for _, failure := range failures {
+		fmt.Fprintf(os.Stderr, "  %v: %v\n", failure.Path, failure.Err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package cmd
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the last access time of the file described by info. The
+// access time isn't available on this platform so the modification time is
+// used instead.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
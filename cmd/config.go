@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var configFile string
+
+// applyConfig sets every flag of cmd that wasn't given on the command line
+// from its GOFILEDEDUP_ environment variable, e.g. GOFILEDEDUP_DDIR, or else
+// from --config. So the precedence is defaults < config file < environment <
+// flags. The config file's keys are the flag names, its format is picked by
+// its extension, e.g. .yaml, .toml or .json.
+func applyConfig(cmd *cobra.Command) error {
+	v := viper.New()
+	v.SetEnvPrefix("GOFILEDEDUP")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading config: %w", err)
+		}
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !v.IsSet(f.Name) {
+			return
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = slice.Replace(v.GetStringSlice(f.Name))
+		} else {
+			err = f.Value.Set(v.GetString(f.Name))
+		}
+		if err != nil {
+			err = fmt.Errorf("config %v: %w", f.Name, err)
+		}
+	})
+	return err
+}
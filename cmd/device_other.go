@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cmd
+
+// device is not supported on this platform so files are always trashed in
+// the home trash.
+func device(path string) (uint64, bool) {
+	return 0, false
+}
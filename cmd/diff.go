@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff OLD_REPORT NEW_REPORT",
+	Short: "Show how the duplicates changed between two --report files.",
+	Long: `Show how the duplicates changed between two --report files.
+		Each group of duplicates that changed is printed as its hash, size and whether it is
+		new, resolved or changed, followed by the paths added to it (+) and removed from it (-).
+	`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		before, err := readReport(args[0])
+		if err != nil {
+			return err
+		}
+		after, err := readReport(args[1])
+		if err != nil {
+			return err
+		}
+
+		oldGroups, newGroups := reportMembers(before), reportMembers(after)
+		sizes := make(map[string]int64)
+		for _, group := range append(before, after...) {
+			sizes[group.Hash] = group.Size
+		}
+		hashes := make([]string, 0, len(sizes))
+		for hash := range sizes {
+			hashes = append(hashes, hash)
+		}
+		sort.Strings(hashes)
+
+		added, resolved := 0, 0
+		for _, hash := range hashes {
+			oldPaths, newPaths := oldGroups[hash], newGroups[hash]
+			plus, minus := missingFrom(newPaths, oldPaths), missingFrom(oldPaths, newPaths)
+			if len(plus) == 0 && len(minus) == 0 {
+				continue
+			}
+
+			state := "changed"
+			if oldPaths == nil {
+				state = "new"
+				added++
+			} else if newPaths == nil {
+				state = "resolved"
+				resolved++
+			}
+			fmt.Printf("%v %v %v\n", hash, formatBytes(sizes[hash]), state)
+			for _, path := range plus {
+				fmt.Printf("  + %v\n", path)
+			}
+			for _, path := range minus {
+				fmt.Printf("  - %v\n", path)
+			}
+		}
+		if !quiet {
+			fmt.Printf("%v new and %v resolved duplicate groups\n", formatCount(added), formatCount(resolved))
+		}
+		return nil
+	},
+}
+
+// reportMembers maps the hash of each group to the set of all its paths.
+func reportMembers(groups []reportGroup) map[string]map[string]bool {
+	members := make(map[string]map[string]bool, len(groups))
+	for _, group := range groups {
+		paths := map[string]bool{group.Kept: true}
+		for _, path := range group.Duplicates {
+			paths[path] = true
+		}
+		members[group.Hash] = paths
+	}
+	return members
+}
+
+// missingFrom returns the paths in a that aren't in b, sorted.
+func missingFrom(a map[string]bool, b map[string]bool) []string {
+	missing := make([]string, 0)
+	for path := range a {
+		if !b[path] {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
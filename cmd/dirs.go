@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var moveDirsTo string
+
+var dirsCmd = &cobra.Command{
+	Use:   "dirs INPUT_DIR...",
+	Short: "List the directories whose files are identical to another directory's.",
+	Long: `List the directories whose files are identical to another directory's.
+		Directories match when they hold files with the same content laid out in the
+		same subdirectories, whatever the files are named. Each group is printed as its
+		hash and size followed by the directory that would be kept, the one whose path
+		sorts first, and its duplicates. Directories inside matching directories aren't
+		listed. Nothing is changed unless --move-to is given, which moves each duplicate
+		directory into it as a whole. Files that aren't scanned, such as empty files or
+		those left out by the filters, aren't compared, so directories holding any
+		aren't moved.
+	`,
+	Args: inputArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if fromStdin {
+			return fmt.Errorf("dirs can not be used with --from-stdin")
+		}
+		result, err := scanInputs(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		groups := result.DirectoryGroups(args)
+		var size int64
+		count := 0
+		for _, group := range groups {
+			fmt.Printf("%v %v\n", group.Hash, formatBytes(group.Kept.Size))
+			fmt.Printf("  keep %v\n", group.Kept.Path)
+			for _, dir := range group.Duplicates {
+				fmt.Printf("  dup  %v\n", dir.Path)
+				size += dir.Size
+				count++
+			}
+		}
+		foundDuplicates = count > 0
+
+		if moveDirsTo != "" {
+			if err := moveDirs(result, groups); err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+		}
+
+		printErrors(result)
+		if !quiet {
+			fmt.Printf("Found %v duplicate directories totaling %v\n", formatCount(count), formatBytes(size))
+			printStats(os.Stdout, result)
+		}
+		return nil
+	},
+}
+
+// moveDirs moves the duplicate directories of groups into --move-to keeping
+// their paths, the outermost first. Directories inside one already moved,
+// or whose kept directory is, are left alone. So nothing that wasn't
+// compared is moved with them, directories holding files that weren't
+// scanned aren't moved either and are reported as failures.
+func moveDirs(result *dedup.Result, groups []dedup.Group) error {
+	sort.SliceStable(groups, func(i, j int) bool {
+		return depthOf(groups[i].Kept.Path) < depthOf(groups[j].Kept.Path)
+	})
+
+	actions, err := openJournal(journalFile)
+	if err != nil {
+		return err
+	}
+	defer actions.Close()
+
+	scanned := make(map[string]bool)
+	for _, file := range result.Files {
+		scanned[absPath(file.Path)] = true
+	}
+	for file := range result.Duplicates {
+		scanned[absPath(file.Path)] = true
+	}
+	for file := range result.Hardlinks {
+		scanned[absPath(file.Path)] = true
+	}
+
+	failed := 0
+	moved := make([]string, 0)
+	inMoved := func(path string) bool {
+		for _, dir := range moved {
+			if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, group := range groups {
+		if inMoved(group.Kept.Path) {
+			logrus.Warnf("Skipping the duplicates of %v, it was moved", group.Kept.Path)
+			continue
+		}
+		for _, dir := range group.Duplicates {
+			if inMoved(dir.Path) {
+				continue
+			}
+			if file, err := unscannedFile(dir.Path, scanned); err != nil || file != "" {
+				if err == nil {
+					err = fmt.Errorf("%v wasn't compared", file)
+				}
+				logrus.Errorf("Not moving %v: %v", dir.Path, err)
+				failed++
+				continue
+			}
+			if err := moveToDirectory(dir.Path, moveDirsTo, ""); err != nil {
+				return err
+			}
+			if err := actions.record("move", dir.Path, destinationPath(dir.Path, moveDirsTo, ""), group.Hash); err != nil {
+				return err
+			}
+			moved = append(moved, filepath.Clean(dir.Path))
+		}
+	}
+	if failed > 0 {
+		return ioError{fmt.Errorf("%v directories weren't moved since they hold files that weren't compared, such as empty, hidden or filtered files", failed)}
+	}
+	return nil
+}
+
+// unscannedFile returns the first file under dir that isn't in scanned, the
+// absolute paths of the files scanned, or "" if there is none.
+func unscannedFile(dir string, scanned map[string]bool) (string, error) {
+	found := ""
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if !scanned[absPath(path)] {
+			found = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+// absPath returns the absolute path of path, or path if it has none.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// depthOf returns how many directories deep path is.
+func depthOf(path string) int {
+	return strings.Count(filepath.Clean(path), string(filepath.Separator))
+}
+
+func init() {
+	addScanFlags(dirsCmd.Flags())
+	dirsCmd.Flags().StringVar(&moveDirsTo, "move-to", "", "Move each duplicate directory into this directory, keeping its relative path. See undo to move them back.")
+	cobra.MarkFlagDirname(dirsCmd.Flags(), "move-to")
+	dirsCmd.Flags().StringVar(&journalFile, "journal", "", "Append a CSV row for every directory moved to this file, see the undo subcommand.")
+	dirsCmd.Flags().BoolVar(&dryrun, "dryrun", false, "Only log the directories that would be moved.")
+	rootCmd.AddCommand(dirsCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+var dumpManifest bool
+
+// dumpManifestName is the file in --ddir written by --dedup-output-manifest.
+const dumpManifestName = "gofilededup-manifest.json"
+
+// dumpEntry records where a file in --ddir came from.
+type dumpEntry struct {
+	Path  string `json:"path"`
+	Moved bool   `json:"moved"`
+	Dump  string `json:"dump"`
+	Hash  string `json:"hash,omitempty"`
+	Kept  string `json:"kept,omitempty"`
+}
+
+// writeDumpManifest adds entries to the manifest in dir, replacing the
+// entries for the same files in --ddir so resumed and repeated runs keep
+// the ones written before. The entries are sorted by their path in dir.
+func writeDumpManifest(dir string, entries []dumpEntry) error {
+	filename := filepath.Join(dir, dumpManifestName)
+	byDump := make(map[string]dumpEntry)
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var existing []dumpEntry
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("%v: %w", filename, err)
+		}
+		for _, entry := range existing {
+			byDump[entry.Dump] = entry
+		}
+	}
+	for _, entry := range entries {
+		byDump[entry.Dump] = entry
+	}
+
+	all := make([]dumpEntry, 0, len(byDump))
+	for _, entry := range byDump {
+		all = append(all, entry)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Dump < all[j].Dump
+	})
+
+	data, err = json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Writing manifest of %v to %v", dir, filename)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/spf13/cobra"
+)
+
+// The exit codes, see the README.
+const (
+	exitNoDuplicates = 0
+	exitDuplicates   = 1
+	exitUsage        = 2
+	exitIO           = 3
+	exitCancelled    = 4
+)
+
+// foundDuplicates records whether the scan found any duplicates, which
+// successful runs report with exitDuplicates.
+var foundDuplicates bool
+
+// errInterrupted is returned when SIGINT or SIGTERM stops a run.
+var errInterrupted = errors.New("interrupted")
+
+// errTimedOut is returned when a run takes longer than --timeout.
+var errTimedOut = errors.New("timed out")
+
+// interrupted returns errTimedOut if the run hit --timeout, otherwise
+// errInterrupted. Neither warrants printing the usage.
+func interrupted(cmd *cobra.Command) error {
+	cmd.SilenceUsage = true
+	if errors.Is(cmd.Context().Err(), context.DeadlineExceeded) {
+		return errTimedOut
+	}
+	return errInterrupted
+}
+
+// ioError marks an error as a failure to read or change files that doesn't
+// come from the os package.
+type ioError struct {
+	error
+}
+
+func (e ioError) Unwrap() error {
+	return e.error
+}
+
+// scanError returns err, an error that stopped a scan, not printing the
+// usage when it is a dedup.ReadError since the flags were fine.
+func scanError(cmd *cobra.Command, err error) error {
+	var readErr dedup.ReadError
+	if errors.As(err, &readErr) {
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// exitCode returns the exit code for a run that ended with err. Errors that
+// aren't cancellations or I/O errors come from bad flags, arguments or
+// config.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	var ioErr ioError
+	var readErr dedup.ReadError
+	switch {
+	case err == nil && (foundDuplicates || foundDifferences):
+		return exitDuplicates
+	case err == nil:
+		return exitNoDuplicates
+	case errors.Is(err, errInterrupted), errors.Is(err, errTimedOut):
+		return exitCancelled
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &syscallErr), errors.As(err, &ioErr), errors.As(err, &readErr):
+		return exitIO
+	default:
+		return exitUsage
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/spf13/cobra"
+)
+
+var byCopies bool
+var top int
+
+var groupsCmd = &cobra.Command{
+	Use:   "groups INPUT_DIR...",
+	Short: "List every group of identical files without changing anything.",
+	Long: `List every group of identical files without changing anything.
+		Each group is printed as its hash and size followed by all the files in it,
+		the file that would be kept first. With --by-copies the groups with the most
+		copies come first, each with how many copies there are and the space they
+		waste. With --similarity-threshold groups of similar images follow, marked
+		similar with their perceptual hash. With --top only the groups wasting the
+		most space are listed, the most first.
+	`,
+	Args: inputArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if top < 0 {
+			return fmt.Errorf("--top must not be negative")
+		}
+		result, err := scanInputs(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		groups := topGroups(result.Groups(), top)
+		if byCopies {
+			sortByCopies(groups)
+		}
+		for i, group := range groups {
+			if i > 0 {
+				fmt.Println()
+			}
+			if byCopies {
+				copies, noun := len(group.Duplicates), "copies"
+				if copies == 1 {
+					noun = "copy"
+				}
+				fmt.Printf("%v %v %v × %v = %v wasted\n", group.Hash, formatCount(copies), noun, formatBytes(group.Kept.Size), formatBytes(wasted(group)))
+			} else {
+				fmt.Printf("%v %v\n", group.Hash, formatBytes(group.Kept.Size))
+			}
+			fmt.Printf("  %v\n", group.Kept.Path)
+			for _, file := range group.Duplicates {
+				fmt.Printf("  %v\n", file.Path)
+			}
+		}
+		for i, group := range result.Similar {
+			if i > 0 || len(groups) > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("similar %v\n", group.Hash)
+			fmt.Printf("  %v\n", group.Kept.Path)
+			for _, file := range group.Duplicates {
+				fmt.Printf("  %v\n", file.Path)
+			}
+		}
+		printErrors(result)
+		if !quiet {
+			printStats(os.Stdout, result)
+		}
+		return nil
+	},
+}
+
+// topGroups returns the n groups wasting the most space, the most first,
+// or all of groups unchanged when n is 0.
+func topGroups(groups []dedup.Group, n int) []dedup.Group {
+	if n == 0 {
+		return groups
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return wasted(groups[i]) > wasted(groups[j])
+	})
+	return groups[:min(n, len(groups))]
+}
+
+// wasted returns the space taken by the duplicates of group.
+func wasted(group dedup.Group) int64 {
+	return int64(len(group.Duplicates)) * group.Kept.Size
+}
+
+// sortByCopies sorts groups by their number of duplicates, most first, then
+// by the space they waste.
+func sortByCopies(groups []dedup.Group) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if len(a.Duplicates) != len(b.Duplicates) {
+			return len(a.Duplicates) > len(b.Duplicates)
+		}
+		return wasted(a) > wasted(b)
+	})
+}
+
+func init() {
+	addScanFlags(groupsCmd.Flags())
+	groupsCmd.Flags().IntVar(&top, "top", 0, "Only list the N groups of duplicates wasting the most space, the most first. 0 lists them all.")
+	groupsCmd.Flags().BoolVar(&byCopies, "by-copies", false, "List the groups with the most copies first, with the number of copies times their size and the space wasted.")
+	rootCmd.AddCommand(groupsCmd)
+}
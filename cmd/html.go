@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+)
+
+var htmlReport string
+
+// thumbnailSize is the largest width or height of the thumbnails in an HTML
+// report.
+const thumbnailSize = 160
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Duplicate files</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+details { border: 1px solid #ccc; border-radius: 4px; margin: 0.5em 0; padding: 0.5em; }
+summary { cursor: pointer; font-weight: bold; }
+img { display: block; margin: 0.5em 0; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 1em 0.2em 0; text-align: left; }
+.kept { color: #070; }
+.hash { color: #888; font-family: monospace; font-size: small; }
+</style>
+</head>
+<body>
+<h1>Duplicate files</h1>
+<p>{{.Duplicates}} duplicate files totaling {{.Size}} in {{len .Groups}} groups.</p>
+{{range .Groups}}<details>
+<summary>{{.Title}}</summary>
+{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="">
+{{end}}<table>
+<tr><th>Status</th><th>Path</th><th>Modified</th></tr>
+{{range .Files}}<tr{{if eq .Status "kept"}} class="kept"{{end}}><td>{{.Status}}</td><td>{{.Path}}</td><td>{{.Modified}}</td></tr>
+{{end}}</table>
+<p class="hash">{{.Hash}}</p>
+</details>
+{{end}}</body>
+</html>
+`))
+
+type htmlFile struct {
+	Status   string
+	Path     string
+	Modified string
+}
+
+type htmlGroup struct {
+	Title     string
+	Hash      string
+	Thumbnail template.URL
+	Files     []htmlFile
+}
+
+// writeHTML writes a self-contained HTML page to filename with a collapsible
+// section for each group of duplicates and of similar images, showing a
+// thumbnail of images.
+func writeHTML(filename string, result *dedup.Result) error {
+	groups := make([]htmlGroup, 0)
+	add := func(group dedup.Group, title string, status string) {
+		files := []htmlFile{{"kept", group.Kept.Path, group.Kept.Time.Format("2006-01-02 15:04")}}
+		for _, file := range group.Duplicates {
+			files = append(files, htmlFile{status, file.Path, file.Time.Format("2006-01-02 15:04")})
+		}
+		groups = append(groups, htmlGroup{title, group.Hash, thumbnail(group.Kept.Path), files})
+	}
+	for _, group := range result.Groups() {
+		add(group, formatCount(len(group.Duplicates)+1)+" copies of "+filepath.Base(group.Kept.Path)+", "+formatBytes(group.Kept.Size)+" each", "duplicate")
+	}
+	for _, group := range result.Similar {
+		add(group, formatCount(len(group.Duplicates)+1)+" images like "+filepath.Base(group.Kept.Path), "similar")
+	}
+
+	var buf bytes.Buffer
+	err := htmlTemplate.Execute(&buf, struct {
+		Duplicates string
+		Size       string
+		Groups     []htmlGroup
+	}{formatCount(len(result.Duplicates)), formatBytes(result.DuplicateSize()), groups})
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Writing HTML report to %v", filename)
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// thumbnail returns a data URL of a small JPEG of the image at path, or the
+// empty URL if it isn't an image that can be decoded.
+func thumbnail(path string) template.URL {
+	ext := strings.ToLower(filepath.Ext(path))
+	isImage := false
+	for _, e := range dedup.ImageExtensions {
+		isImage = isImage || ext == e
+	}
+	if !isImage {
+		return ""
+	}
+
+	f, err := os.Open(dedup.LongPath(path))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		logrus.Debugf("No thumbnail for %v: %v", path, err)
+		return ""
+	}
+
+	// nearest neighbour is plenty for a preview
+	b := img.Bounds()
+	if b.Empty() {
+		return ""
+	}
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailSize || h > thumbnailSize {
+		if w > h {
+			w, h = thumbnailSize, max(1, h*thumbnailSize/w)
+		} else {
+			w, h = max(1, w*thumbnailSize/h), thumbnailSize
+		}
+	}
+	small := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			small.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, small, &jpeg.Options{Quality: 75}); err != nil {
+		return ""
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nathanhack/gofilededup/dedup"
+)
+
+var interactive bool
+
+// review asks which file of each group of duplicates in dupFiles to keep,
+// suggesting the file kept by --keep. It returns the duplicates to act on,
+// leaving out the groups that were skipped, and updates result with the files
+// chosen. Once in runs out the remaining groups are skipped. Reference files
+// and archive members are listed but can't be chosen over the suggestion, as
+// they are never acted on and the other files would be removed in their
+// favor.
+func review(in io.Reader, out io.Writer, result *dedup.Result, dupFiles map[dedup.PathTime]string) (map[dedup.PathTime]string, error) {
+	reviewed := make(map[dedup.PathTime]string, len(dupFiles))
+	for file, sha := range dupFiles {
+		// similar images aren't in a group of duplicates
+		if sha == "" {
+			reviewed[file] = sha
+		}
+	}
+
+	groups := make([]dedup.Group, 0)
+	for _, group := range result.Groups() {
+		for _, file := range group.Duplicates {
+			if _, has := dupFiles[file]; has {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+
+	r := bufio.NewReader(in)
+	done := false
+	for i, group := range groups {
+		if done {
+			break
+		}
+		members := append([]dedup.PathTime{group.Kept}, group.Duplicates...)
+		choices := []dedup.PathTime{group.Kept}
+		fmt.Fprintf(out, "\nGroup %v of %v, hash %v:\n", i+1, len(groups), group.Hash)
+		for n, file := range members {
+			suggested := "      "
+			if n == 0 {
+				suggested = "[keep]"
+			}
+			number := "-"
+			if n == 0 {
+				number = "1"
+			} else if keepable(result, dupFiles, group.Kept, file) {
+				choices = append(choices, file)
+				number = strconv.Itoa(len(choices))
+			} else if result.References[file] {
+				suggested = "[ref] "
+			} else if result.ArchiveMembers[file] {
+				suggested = "[arch]"
+			}
+			fmt.Fprintf(out, "  %v) %v %v  %v  %v\n", number, suggested, formatBytes(file.Size), file.Time.Format("2006-01-02 15:04"), file.Path)
+		}
+
+		for {
+			if len(choices) == 1 {
+				fmt.Fprint(out, "Keep file 1? [Enter to keep it, s to skip] ")
+			} else {
+				fmt.Fprintf(out, "Keep which file? [1-%v, Enter for 1, s to skip] ", len(choices))
+			}
+			answer, err := r.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if errors.Is(err, io.EOF) && answer == "" {
+				fmt.Fprintln(out)
+				done = true
+				break
+			}
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "s" {
+				break
+			}
+			choice := 1
+			if answer != "" {
+				choice, err = strconv.Atoi(answer)
+				if err != nil || choice < 1 || choice > len(choices) {
+					fmt.Fprintf(out, "%q is not a file number\n", answer)
+					continue
+				}
+			}
+
+			kept := choices[choice-1]
+			if kept != group.Kept {
+				result.Files[group.Hash] = kept
+				delete(result.Duplicates, kept)
+				result.Duplicates[group.Kept] = group.Hash
+			}
+			for _, file := range members {
+				// files left out of dupFiles, e.g. inside archives, stay left out
+				// and reference files are never acted on
+				if _, has := dupFiles[file]; file != kept && !result.References[file] && !result.ArchiveMembers[file] && (has || file == group.Kept) {
+					reviewed[file] = group.Hash
+				}
+			}
+			break
+		}
+	}
+	return reviewed, nil
+}
+
+// keepable reports whether file may be chosen over kept, the file kept by
+// --keep. Only files that would be acted on can be, and none can be chosen
+// over a reference file.
+func keepable(result *dedup.Result, dupFiles map[dedup.PathTime]string, kept dedup.PathTime, file dedup.PathTime) bool {
+	if result.References[kept] || result.References[file] || result.ArchiveMembers[file] {
+		return false
+	}
+	_, has := dupFiles[file]
+	return has
+}
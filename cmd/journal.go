@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+)
+
+var journalFile string
+var resume bool
+
+// journal is a CSV file with a row of action, source, destination, hash and
+// time for every file that was changed, see the undo subcommand. A nil
+// journal records nothing.
+type journal struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+}
+
+// openJournal opens filename to append to, it returns a nil journal when
+// filename is empty or this is a dryrun.
+func openJournal(filename string) (*journal, error) {
+	if filename == "" || dryrun {
+		return nil, nil
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f, w: csv.NewWriter(f)}, nil
+}
+
+// record appends an action on the file source to the journal, flushing it
+// right away so the journal is complete even if the run is killed. It is
+// safe to call from several goroutines.
+func (j *journal) record(action string, source string, destination string, hash string) error {
+	if j == nil {
+		return nil
+	}
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	if destination != "" {
+		destination, err = filepath.Abs(destination)
+		if err != nil {
+			return err
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.w.Write([]string{action, source, destination, hash, time.Now().Format(time.RFC3339)})
+	j.w.Flush()
+	return j.w.Error()
+}
+
+func (j *journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+// journalEntries are the actions recorded by an earlier run, which --resume
+// doesn't do again.
+type journalEntries struct {
+	done  map[[3]string]bool
+	moves []string
+}
+
+// readJournal reads the actions recorded in filename, which may not exist
+// yet.
+func readJournal(filename string) (*journalEntries, error) {
+	entries := &journalEntries{done: map[[3]string]bool{}}
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 5
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		entries.done[[3]string{row[0], row[1], row[2]}] = true
+		if row[0] == "move" {
+			entries.moves = append(entries.moves, row[2])
+		}
+	}
+	return entries, nil
+}
+
+// has reports whether the action on source was recorded.
+func (e *journalEntries) has(action string, source string, destination string) bool {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return false
+	}
+	destination, err = filepath.Abs(destination)
+	if err != nil {
+		return false
+	}
+	return e.done[[3]string{action, source, destination}]
+}
+
+// reserveMoved marks the names of the files moved into dir as used, so the
+// files left to flatten are named as they would have been had the earlier
+// run finished.
+func (e *journalEntries) reserveMoved(dir string, used map[string]int, foldCase bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	for _, destination := range e.moves {
+		if name, err := filepath.Rel(abs, destination); err == nil && filepath.IsLocal(name) {
+			flattenName(name, used, foldCase)
+		}
+	}
+}
+
+// notDone returns the files and their names in dir whose action wasn't
+// recorded.
+func (e *journalEntries) notDone(action string, files []dedup.PathTime, names []string, dir string) ([]dedup.PathTime, []string) {
+	todoFiles := make([]dedup.PathTime, 0, len(files))
+	todoNames := make([]string, 0, len(names))
+	for i, file := range files {
+		if e.has(action, file.Path, destinationPath(file.Path, dir, names[i])) {
+			logrus.Infof("Skipping %v, it was already done", file.Path)
+			continue
+		}
+		todoFiles = append(todoFiles, file)
+		todoNames = append(todoNames, names[i])
+	}
+	return todoFiles, todoNames
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+)
+
+var logSummaryInterval time.Duration
+
+// summary is the logrus formatter installed by --log-summary, nil without it.
+var summary *summaryFormatter
+
+// summaryFormatter counts the log entries below error level instead of
+// writing them, and at most every interval writes one line with how many
+// there were and how far hashing got. Errors are always written.
+type summaryFormatter struct {
+	logrus.Formatter
+	interval time.Duration
+
+	mu       sync.Mutex
+	last     time.Time
+	counts   map[logrus.Level]int
+	progress dedup.Progress
+}
+
+// newLogSummary installs a summaryFormatter writing a line every interval.
+func newLogSummary(interval time.Duration) *summaryFormatter {
+	f := &summaryFormatter{
+		Formatter: logrus.StandardLogger().Formatter,
+		interval:  interval,
+		last:      time.Now(),
+		counts:    make(map[logrus.Level]int),
+	}
+	logrus.SetFormatter(f)
+	return f
+}
+
+func (f *summaryFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level <= logrus.ErrorLevel {
+		return f.Formatter.Format(entry)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[entry.Level]++
+	if time.Since(f.last) < f.interval {
+		return nil, nil
+	}
+	return f.line()
+}
+
+// onProgress records how far hashing got, writing the summary line if it is
+// due so it is written even while nothing is logged.
+func (f *summaryFormatter) onProgress(p dedup.Progress) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.progress = p
+	if time.Since(f.last) < f.interval {
+		return
+	}
+	f.write()
+}
+
+// flush writes the summary of what was logged since the last line, if
+// anything was.
+func (f *summaryFormatter) flush() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.counts) > 0 {
+		f.write()
+	}
+}
+
+// write writes the summary line to the log output.
+func (f *summaryFormatter) write() {
+	data, err := f.line()
+	if err == nil {
+		logrus.StandardLogger().Out.Write(data)
+	}
+}
+
+// line formats the summary line and starts counting again.
+func (f *summaryFormatter) line() ([]byte, error) {
+	parts := make([]string, 0, 2)
+	if f.progress.TotalFiles > 0 {
+		parts = append(parts, fmt.Sprintf("hashed %v/%v files, %v", formatCount(f.progress.Files), formatCount(f.progress.TotalFiles), formatBytes(f.progress.Bytes)))
+	}
+	levels := make([]logrus.Level, 0, len(f.counts))
+	for level := range f.counts {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i] < levels[j]
+	})
+	if len(levels) > 0 {
+		counts := make([]string, 0, len(levels))
+		for _, level := range levels {
+			counts = append(counts, fmt.Sprintf("%v %v", formatCount(f.counts[level]), level))
+		}
+		parts = append(parts, strings.Join(counts, " and ")+" messages not shown")
+	}
+	f.counts = make(map[logrus.Level]int)
+	f.last = time.Now()
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	entry.Time = f.last
+	entry.Level = logrus.InfoLevel
+	entry.Message = "Summary: " + strings.Join(parts, ", ")
+	return f.Formatter.Format(entry)
+}
+
+// withLogSummary returns a progress callback that also records the progress
+// for --log-summary, calling next if it isn't nil.
+func withLogSummary(next func(dedup.Progress)) func(dedup.Progress) {
+	if summary == nil {
+		return next
+	}
+	return func(p dedup.Progress) {
+		summary.onProgress(p)
+		if next != nil {
+			next(p)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var manifestOutput string
+
+// foundDifferences records whether verify found files that are missing,
+// changed or extra, which it reports with exitDuplicates.
+var foundDifferences bool
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest INPUT_DIR",
+	Short: "Write the path, size, modification time and hash of every file to a CSV manifest.",
+	Long: `Write the path, size, modification time and hash of every file to a CSV manifest.
+		The paths are relative to INPUT_DIR with forward slashes so a copy of it elsewhere,
+		such as a backup, can be checked against the manifest with verify. Empty files are
+		included. The manifest is written to stdout unless --output is given.
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := manifestEntries(cmd, args[0])
+		if err != nil {
+			return err
+		}
+
+		if manifestOutput == "" {
+			return writeManifest(os.Stdout, entries)
+		}
+		logrus.Infof("Writing manifest to %v", manifestOutput)
+		f, err := os.Create(manifestOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := writeManifest(f, entries); err != nil {
+			return err
+		}
+		return f.Close()
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify MANIFEST INPUT_DIR",
+	Short: "Check the files in a directory against a manifest.",
+	Long: `Check the files in a directory against a manifest.
+		Every file in the manifest that isn't in INPUT_DIR is printed as missing, every
+		file whose size or hash differs as changed and every file not in the manifest as
+		extra. Modification times aren't compared since copies rarely keep them. Use the
+		same --hash and filters the manifest was written with. Exits with 1 when any
+		file differs.
+	`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		expected, err := readManifest(f)
+		if err != nil {
+			return fmt.Errorf("%v: %w", args[0], err)
+		}
+
+		entries, err := manifestEntries(cmd, args[1])
+		if err != nil {
+			return err
+		}
+		actual := make(map[string]manifestEntry, len(entries))
+		for _, entry := range entries {
+			actual[entry.Path] = entry
+		}
+
+		paths := make([]string, 0, len(expected)+len(actual))
+		for path := range expected {
+			paths = append(paths, path)
+		}
+		for path := range actual {
+			if _, has := expected[path]; !has {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+
+		missing, changed, extra := 0, 0, 0
+		for _, path := range paths {
+			want, inManifest := expected[path]
+			got, inDir := actual[path]
+			switch {
+			case !inDir:
+				fmt.Printf("missing %v\n", path)
+				missing++
+			case !inManifest:
+				fmt.Printf("extra   %v\n", path)
+				extra++
+			case want.Size != got.Size || want.Hash != got.Hash:
+				fmt.Printf("changed %v\n", path)
+				changed++
+			}
+		}
+		foundDifferences = missing+changed+extra > 0
+		if !quiet {
+			fmt.Printf("%v missing, %v changed and %v extra files\n", formatCount(missing), formatCount(changed), formatCount(extra))
+		}
+		return nil
+	},
+}
+
+// manifestEntry is a file in a manifest, its path relative to the directory
+// the manifest is of.
+type manifestEntry struct {
+	Path string
+	Size int64
+	Time time.Time
+	Hash string
+}
+
+// manifestEntries hashes every file under dir with the scan flags, returning
+// them with their paths relative to dir.
+func manifestEntries(cmd *cobra.Command, dir string) ([]manifestEntry, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("input directory must exist: %v", dir)
+	}
+
+	d, err := newDeduplicator()
+	if err != nil {
+		return nil, err
+	}
+	d.IncludeEmpty = true
+
+	found, errs, err := d.Manifest(cmd.Context(), dir)
+	if err != nil && cmd.Context().Err() == nil {
+		return nil, scanError(cmd, err)
+	}
+	if cache != "" {
+		if err := d.Cache.Save(cache); err != nil {
+			return nil, err
+		}
+	}
+	printErrors(&dedup.Result{Errors: errs})
+	if err != nil {
+		return nil, interrupted(cmd)
+	}
+
+	entries := make([]manifestEntry, 0, len(found))
+	for _, entry := range found {
+		rel, err := filepath.Rel(dir, entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, manifestEntry{filepath.ToSlash(rel), entry.Size, entry.Time, entry.Hash})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// writeManifest writes entries to w as CSV with a header row.
+func writeManifest(w io.Writer, entries []manifestEntry) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"path", "size", "mtime", "sha"})
+	for _, entry := range entries {
+		c.Write([]string{entry.Path, strconv.FormatInt(entry.Size, 10), entry.Time.UTC().Format(time.RFC3339Nano), entry.Hash})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// readManifest reads the entries written by writeManifest, by path.
+func readManifest(r io.Reader) (map[string]manifestEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) != 4 || rows[0][0] != "path" {
+		return nil, fmt.Errorf("not a manifest, the header must be path,size,mtime,sha")
+	}
+
+	entries := make(map[string]manifestEntry, len(rows)-1)
+	for i, row := range rows[1:] {
+		size, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid size: %w", i+2, err)
+		}
+		mtime, err := time.Parse(time.RFC3339Nano, row[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid mtime: %w", i+2, err)
+		}
+		entries[row[0]] = manifestEntry{row[0], size, mtime, row[3]}
+	}
+	return entries, nil
+}
+
+func init() {
+	addScanFlags(manifestCmd.Flags())
+	manifestCmd.Flags().StringVarP(&manifestOutput, "output", "o", "", "Write the manifest to this file instead of stdout.")
+	rootCmd.AddCommand(manifestCmd)
+	addScanFlags(verifyCmd.Flags())
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"golang.org/x/term"
+)
+
+var showProgress bool
+
+const updateInterval = 200 * time.Millisecond
+
+// newProgress returns a callback printing how many of the files to be hashed
+// have been hashed so far to stderr, at most every updateInterval. It returns
+// nil if progress reporting is disabled, --quiet is set or stdout is not a
+// terminal.
+func newProgress() func(dedup.Progress) {
+	if !showProgress || quiet || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+
+	var lastUpdate time.Time
+	return func(p dedup.Progress) {
+		if p.Files != p.TotalFiles && time.Since(lastUpdate) < updateInterval {
+			return
+		}
+		lastUpdate = time.Now()
+
+		percent := 100.0
+		if p.TotalBytes > 0 {
+			percent = 100 * float64(p.Bytes) / float64(p.TotalBytes)
+		}
+		fmt.Fprintf(os.Stderr, "\rHashed %v/%v files (%.1f%%)", p.Files, p.TotalFiles, percent)
+		if p.Files == p.TotalFiles {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+)
+
+var report string
+var csvFile string
+
+// writeReports writes the --report, --csv, --sumfile and --html-report files
+// when they are set.
+func writeReports(result *dedup.Result) error {
+	if report != "" {
+		if err := writeReport(report, result); err != nil {
+			return err
+		}
+	}
+
+	if csvFile != "" {
+		if err := writeCSV(csvFile, result); err != nil {
+			return err
+		}
+	}
+
+	if sumFile != "" {
+		if err := writeSums(sumFile, result); err != nil {
+			return err
+		}
+	}
+
+	if htmlReport != "" {
+		if err := writeHTML(htmlReport, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type reportGroup struct {
+	Hash       string   `json:"hash"`
+	Kept       string   `json:"kept"`
+	Duplicates []string `json:"duplicates"`
+	Size       int64    `json:"size"`
+}
+
+// writeReport writes a JSON document to filename describing each group of
+// duplicate files, sorted by hash.
+func writeReport(filename string, result *dedup.Result) error {
+	data, err := reportJSON(result)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Writing report to %v", filename)
+	return os.WriteFile(filename, data, 0644)
+}
+
+// readReport reads the duplicate groups from a JSON report written by
+// writeReport.
+func readReport(filename string) ([]reportGroup, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var groups []reportGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+	return groups, nil
+}
+
+// reportJSON returns the JSON document describing each group of duplicate
+// files, sorted by hash.
+func reportJSON(result *dedup.Result) ([]byte, error) {
+	groups := make([]reportGroup, 0)
+	for _, group := range result.Groups() {
+		duplicates := make([]string, 0, len(group.Duplicates))
+		for _, file := range group.Duplicates {
+			duplicates = append(duplicates, file.Path)
+		}
+		groups = append(groups, reportGroup{group.Hash, group.Kept.Path, duplicates, group.Kept.Size})
+	}
+
+	return json.MarshalIndent(groups, "", "  ")
+}
+
+// writeCSV writes a CSV file to filename with one row per hashed file, sorted
+// by hash with the kept file first.
+func writeCSV(filename string, result *dedup.Result) error {
+	type row struct {
+		file   dedup.PathTime
+		hash   string
+		status string
+	}
+
+	rows := make([]row, 0, len(result.Files)+len(result.Duplicates))
+	for sha, file := range result.Files {
+		rows = append(rows, row{file, sha, "kept"})
+	}
+	for file, sha := range result.Duplicates {
+		rows = append(rows, row{file, sha, "duplicate"})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].hash != rows[j].hash {
+			return rows[i].hash < rows[j].hash
+		}
+		if rows[i].status != rows[j].status {
+			return rows[i].status == "kept"
+		}
+		return rows[i].file.Path < rows[j].file.Path
+	})
+
+	logrus.Infof("Writing CSV to %v", filename)
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"hash", "size", "status", "path"})
+	for _, r := range rows {
+		w.Write([]string{r.hash, strconv.FormatInt(r.file.Size, 10), r.status, r.file.Path})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -1,223 +1,1056 @@
 package cmd
 
 import (
-	"crypto/sha256"
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/nathanhack/gofilededup/dedup"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var ddir string
-var dedup bool
+var ddup bool
 var rdup bool
 var remove bool
 var fdir string
 var flatten bool
+var hardlink bool
+var symlink bool
+var preserve bool
+var trash bool
+var yes bool
+var logLevel string
+var quiet bool
+var skipSpaceCheck bool
+var dryrun bool
+var fuzzyDelete bool
+var caseInsensitiveNames bool
+var ddirLayout string
+var stripPrefix string
+var dirMode string
+var flattenSuffix string
 
-type PathTime struct {
-	Path string
-	Time time.Time
-}
+// dirPerm is the mode of the directories created in --ddir and --fdir, see
+// --dir-mode.
+var dirPerm os.FileMode = 0755
+
+var flattenKeepDepth int
+var preserveDirTimes bool
+var excludeSameDir bool
+var leaveSymlink string
+var actByName bool
+var limitCopies bool
+var timeout time.Duration
+
+// started is when the run started, for the wall time printed by --stats.
+var started = time.Now()
+
+// stopTimeout releases the --timeout context once the command returns.
+var stopTimeout context.CancelFunc = func() {}
 
-var files = map[string]PathTime{}
-var dupFiles = map[PathTime]bool{}
-var dryrun bool
 var rootCmd = &cobra.Command{
-	Use:   "gofilededup INPUT_DIR",
+	Use:   "gofilededup INPUT_DIR...",
 	Short: "Commandline tool to dedup files.",
 	Long: `Commandline tool to dedup files.
-		When dups are found the oldest and shortest name wins.
+		When dups are found the --keep policy decides which one wins, by default the oldest.
 		Dups are moved to the dupDump directory.
-		Empty files are skipped.
+		Empty files are skipped unless --include-empty is given, then only one of them is kept.
+		Paths matching the patterns in a .dedupignore file in an input directory are skipped.
+		Duplicates are found across all the input directories.
+		Exits with 0 when no duplicates were found, 1 when some were, 2 for bad flags,
+		arguments or config, 3 when files couldn't be read or changed and 4 when
+		interrupted or timed out.
 	`,
-	Args: cobra.ExactArgs(1),
+	Args: inputArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+
+		if quiet {
+			if cmd.Flags().Changed("log-level") {
+				return fmt.Errorf("--quiet can not be used with --log-level")
+			}
+			logLevel = "error"
+		}
+
+		switch logLevel {
+		case "debug", "info", "warn", "error":
+		default:
+			return fmt.Errorf("unknown log level %q, must be one of debug, info, warn or error", logLevel)
+		}
+		level, err := logrus.ParseLevel(logLevel)
+		if err != nil {
+			return err
+		}
+		logrus.SetLevel(level)
+
+		if logSummaryInterval < 0 {
+			return fmt.Errorf("--log-summary must not be negative")
+		}
+		if logSummaryInterval > 0 {
+			if quiet {
+				return fmt.Errorf("--quiet can not be used with --log-summary")
+			}
+			summary = newLogSummary(logSummaryInterval)
+		}
+
+		if timeout < 0 {
+			return fmt.Errorf("timeout must not be negative")
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cmd.SetContext(ctx)
+			stopTimeout = cancel
+		}
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return fmt.Errorf("requires the path to the input directory to deduplicate files")
+		if hardlink && (ddup || rdup) {
+			return fmt.Errorf("--hardlink can not be used with --dedup or --rdup")
 		}
 
-		if _, err := os.Stat(args[0]); errors.Is(err, os.ErrNotExist) {
-			return fmt.Errorf("input directory to deduplicate file must exist")
+		if symlink && (ddup || rdup || hardlink) {
+			return fmt.Errorf("--symlink can not be used with --dedup, --rdup or --hardlink")
 		}
 
-		if flatten {
+		if trash && !canTrash {
+			return fmt.Errorf("--trash is not supported on %v", runtime.GOOS)
+		}
+
+		if flattenKeepDepth < 0 {
+			return fmt.Errorf("--flatten-keep-depth must not be negative")
+		}
+
+		if !strings.Contains(flattenSuffix, "{n}") || strings.ContainsAny(flattenSuffix, `/\`) {
+			return fmt.Errorf("invalid --flatten-suffix %q, it must contain {n} and no path separators", flattenSuffix)
+		}
+
+		perm, err := strconv.ParseUint(dirMode, 8, 32)
+		if err != nil || perm > 0777 {
+			return fmt.Errorf("invalid --dir-mode %q, must be octal permissions such as 0755", dirMode)
+		}
+		dirPerm = os.FileMode(perm)
+
+		if actionWorkers < 1 {
+			return fmt.Errorf("action workers must be at least 1")
+		}
+
+		if ddirLayout != "mirror" && ddirLayout != "flat" {
+			return fmt.Errorf("unknown --ddir-layout %q, must be mirror or flat", ddirLayout)
+		}
+
+		if leaveSymlink != "" && leaveSymlink != "ddir" && leaveSymlink != "kept" {
+			return fmt.Errorf("unknown --leave-symlink %q, must be ddir or kept", leaveSymlink)
+		}
+
+		if stripPrefix != "" && (!ddup || ddirLayout != "mirror") {
+			return fmt.Errorf("--strip-prefix requires --dedup with the mirror --ddir-layout")
+		}
+
+		if dumpManifest && !ddup {
+			return fmt.Errorf("--dedup-output-manifest requires --dedup")
+		}
+
+		if leaveSymlink != "" && !(ddup && rdup) {
+			return fmt.Errorf("--leave-symlink requires --dedup and --rdup")
+		}
+
+		// the kept files are moved into --fdir, leaving the links to them dangling
+		if flatten && remove && (symlink || leaveSymlink == "kept") {
+			return fmt.Errorf("--symlink and --leave-symlink kept can not be used with --flatten --remove")
+		}
+
+		if (byName || byNameSize) && !actByName && (ddup || rdup || hardlink || symlink || flatten) {
+			return fmt.Errorf("--by-name and --by-name-size only report since files with the same name can differ, add --act-by-name to change files anyway")
+		}
+
+		if fuzzyDelete && (!rdup || similarityThreshold < 0) {
+			return fmt.Errorf("--fuzzy-delete requires --rdup and --similarity-threshold")
+		}
+
+		if interactive && fromStdin {
+			return fmt.Errorf("--interactive can not be used with --from-stdin since stdin is needed for the answers")
+		}
+
+		if fromStdin && rdup && !dryrun && !yes {
+			return fmt.Errorf("--from-stdin with --rdup requires --yes since stdin can't be used to confirm")
+		}
+
+		if limitCopies && maxReadRate == "" {
+			return fmt.Errorf("--limit-copies requires --max-read-rate")
+		}
+
+		if resume && journalFile == "" {
+			return fmt.Errorf("--resume requires --journal")
+		}
+
+		// a resumed run carries on flattening into the directory
+		if flatten && !resume {
 			if _, err := os.Stat(fdir); !errors.Is(err, os.ErrNotExist) {
 				return fmt.Errorf("flatten directory must not exist")
 			}
 		}
 
-		err := filepath.Walk(args[0], func(path string, info os.FileInfo, e error) error {
-			if e != nil {
-				logrus.Error(e)
-				return e
-			}
+		result, err := scanInputs(cmd, args)
+		if err != nil {
+			return err
+		}
 
-			if info.Mode().IsDir() {
-				return nil
-			}
+		if err := writeReports(result); err != nil {
+			return err
+		}
 
-			if info.Size() == 0 {
-				logrus.Infof("Found: %v : SKIPPING filesize:0", path)
-				return nil
+		dupFiles := result.Duplicates
+		if fuzzyDelete {
+			dupFiles = withSimilar(result)
+		}
+		dupFiles = outsideArchives(result, dupFiles)
+		if excludeSameDir {
+			dupFiles = outsideSameDir(result, dupFiles)
+		}
+		if interactive {
+			dupFiles, err = review(os.Stdin, os.Stdout, result, dupFiles)
+			if err != nil {
+				return err
 			}
-
-			// for each file we open and run sha256 on it
-			f, err := os.Open(path)
+		}
+		if !quiet {
+			printPairs(os.Stdout, result, dupFiles)
+		}
+		if rdup && !dryrun && !yes && !interactive && len(dupFiles) > 0 {
+			proceed, err := confirm(os.Stdin, dupFiles)
 			if err != nil {
-				logrus.Error(err)
 				return err
 			}
-			defer f.Close()
-
-			h := sha256.New()
-			if _, err := io.Copy(h, f); err != nil {
-				logrus.Fatal(err)
+			if !proceed {
+				logrus.Warnf("Aborted, no files were changed")
 				return nil
 			}
+		}
 
-			sha := fmt.Sprintf("%x", h.Sum(nil))
-			logrus.Infof("Found: %v : %v", path, sha)
-			// now we keep a history so we check if it's already in the history
-			// if not we add it
-			// and if it does exist we do some checks to decide which file will be the "duplicate"
-
-			old, has := files[sha]
-
-			fileInfo := PathTime{path, info.ModTime()}
-			if !has {
-				files[sha] = fileInfo
-				return nil
+		if !dryrun && !skipSpaceCheck {
+			if ddup && !rdup {
+				if err := checkSpace(ddir, result.DuplicateSize()); err != nil {
+					return err
+				}
 			}
-
-			if old.Time.After(info.ModTime()) || len(old.Path) > len(path) {
-				delete(dupFiles, files[sha])
-				files[sha] = fileInfo
-
+			if flatten && !remove {
+				var size int64
+				for _, file := range flattenFiles(result, dupFiles) {
+					size += file.Size
+				}
+				if err := checkSpace(fdir, size); err != nil {
+					return err
+				}
 			}
-			dupFiles[fileInfo] = true
-
-			return nil
-		})
+		}
 
+		actions, err := openJournal(journalFile)
 		if err != nil {
 			return err
 		}
+		defer actions.Close()
+		done := &journalEntries{done: map[[3]string]bool{}}
+		if resume {
+			done, err = readJournal(journalFile)
+			if err != nil {
+				return err
+			}
+		}
+		failures := make([]dedup.FileError, 0)
+
+		if ddup {
+			// with the flat layout duplicates are named like flattened files
+			ddirNames := make(map[string]int)
+			ddirName := func(file dedup.PathTime) string {
+				if ddirLayout == "flat" {
+					return flattenName(filepath.Base(file.Path), ddirNames, caseInsensitiveNames)
+				}
+				return strippedPath(file.Path, stripPrefix)
+			}
+
+			// names are given out before the workers start so they
+			// don't depend on which file is copied first
+			done.reserveMoved(ddir, ddirNames, caseInsensitiveNames)
+			if dumpManifest && ddirLayout == "flat" {
+				flattenName(dumpManifestName, ddirNames, caseInsensitiveNames)
+			}
+			files := sortedByPath(dupFiles)
+			names := make([]string, len(files))
+			for i, file := range files {
+				names[i] = ddirName(file)
+			}
+			// what each file in ddir duplicated, for --dedup-output-manifest
+			dumped := func(errs []error, moved bool) []dumpEntry {
+				entries := make([]dumpEntry, 0, len(files))
+				for i, file := range files {
+					if errs[i] != nil {
+						continue
+					}
+					entry := dumpEntry{file.Path, moved, destinationPath(file.Path, ddir, names[i]), dupFiles[file], ""}
+					if entry.Hash != "" {
+						entry.Kept = result.Files[entry.Hash].Path
+					}
+					entries = append(entries, entry)
+				}
+				return entries
+			}
 
-		if dedup {
 			if rdup {
 				logrus.Infof("Duplicate files will be moved to %v", ddir)
-				for file := range dupFiles {
-					moveToDirectory(file.Path, ddir, file.Path)
+				files, names = done.notDone("move", files, names, ddir)
+				errs := runParallel(cmd.Context(), len(files), func(i int) error {
+					if err := moveToDirectory(files[i].Path, ddir, names[i]); err != nil {
+						return err
+					}
+					return actions.record("move", files[i].Path, destinationPath(files[i].Path, ddir, names[i]), dupFiles[files[i]])
+				})
+				linkErrs := make([]error, len(files))
+				for i, file := range files {
+					if errs[i] != nil {
+						linkErrs[i] = errs[i]
+						continue
+					}
+					sha := dupFiles[file]
+					// the symlink keeps the old path working, undo
+					// replaces it when moving the file back
+					target := ""
+					if leaveSymlink == "ddir" {
+						target = destinationPath(file.Path, ddir, names[i])
+					} else if leaveSymlink == "kept" && sha != "" {
+						target = result.Files[sha].Path
+					}
+					if target == "" {
+						continue
+					}
+					if err := symlinkToFile(file.Path, target); err != nil {
+						linkErrs[i] = err
+						continue
+					}
+					if err := actions.record("leave-symlink", file.Path, target, sha); err != nil {
+						return err
+					}
+				}
+				// the files moved before an interrupt are recorded too
+				if dumpManifest && !dryrun {
+					if err := writeDumpManifest(ddir, dumped(errs, true)); err != nil {
+						return err
+					}
 				}
+				if cmd.Context().Err() != nil {
+					return interrupted(cmd)
+				}
+				failed, err := actionFailures(cmd, files, linkErrs)
+				if err != nil {
+					return err
+				}
+				failures = append(failures, failed...)
 			} else {
 				logrus.Infof("Duplicate files will be copied to %v", ddir)
-				for file := range dupFiles {
-					copyToDirectory(file.Path, ddir, file.Path)
+				files, names = done.notDone("copy", files, names, ddir)
+				errs := runParallel(cmd.Context(), len(files), func(i int) error {
+					if err := copyToDirectory(files[i].Path, ddir, names[i]); err != nil {
+						return err
+					}
+					return actions.record("copy", files[i].Path, destinationPath(files[i].Path, ddir, names[i]), dupFiles[files[i]])
+				})
+				if dumpManifest && !dryrun {
+					if err := writeDumpManifest(ddir, dumped(errs, false)); err != nil {
+						return err
+					}
 				}
+				if cmd.Context().Err() != nil {
+					return interrupted(cmd)
+				}
+				failed, err := actionFailures(cmd, files, errs)
+				if err != nil {
+					return err
+				}
+				failures = append(failures, failed...)
 			}
 		} else if rdup {
-			logrus.Infof("Duplicate files will be removed from %v", args[0])
-			for file := range dupFiles {
-				filename := filepath.Join(filepath.Dir(filepath.Clean(args[0])), file.Path)
-				logrus.Warnf("Removing %v", filename)
-				if !dryrun {
-					err := os.Remove(filename)
-					if err != nil {
-						return err
+			if fromStdin {
+				logrus.Infof("Duplicate files will be removed")
+			} else {
+				logrus.Infof("Duplicate files will be removed from %v", strings.Join(args, ", "))
+			}
+			files := sortedByPath(dupFiles)
+			errs := make([]error, len(files))
+			for i, file := range files {
+				sha := dupFiles[file]
+				if cmd.Context().Err() != nil {
+					return interrupted(cmd)
+				}
+				if trash {
+					logrus.Warnf("Trashing %v", file.Path)
+				} else {
+					logrus.Warnf("Removing %v", file.Path)
+				}
+				if dryrun {
+					continue
+				}
+
+				action := "remove"
+				if trash {
+					action = "trash"
+					err = moveToTrash(file.Path)
+				} else {
+					err = os.Remove(dedup.LongPath(file.Path))
+				}
+				if err != nil {
+					logrus.Error(err)
+					errs[i] = err
+					if !skipErrors {
+						break
 					}
+					continue
+				}
+				if err := actions.record(action, file.Path, "", sha); err != nil {
+					return err
+				}
+			}
+			failed, err := actionFailures(cmd, files, errs)
+			if err != nil {
+				return err
+			}
+			failures = append(failures, failed...)
+		} else if hardlink {
+			logrus.Infof("Duplicate files will be replaced with hardlinks")
+			files := sortedByPath(dupFiles)
+			errs := make([]error, len(files))
+			for i, file := range files {
+				sha := dupFiles[file]
+				if cmd.Context().Err() != nil {
+					return interrupted(cmd)
+				}
+				if sameFile(file.Path, result.Files[sha].Path) {
+					// only found with --follow-hardlinks-as-unique
+					logrus.Debugf("Skipping %v: it already is a hardlink of %v", file.Path, result.Files[sha].Path)
+					continue
+				}
+				err := hardlinkToFile(file.Path, result.Files[sha].Path)
+				if errors.Is(err, errCrossDevice) {
+					continue
+				}
+				if err != nil {
+					errs[i] = err
+					if !skipErrors {
+						break
+					}
+					continue
+				}
+				if err := actions.record("hardlink", file.Path, result.Files[sha].Path, sha); err != nil {
+					return err
 				}
 			}
+			failed, err := actionFailures(cmd, files, errs)
+			if err != nil {
+				return err
+			}
+			failures = append(failures, failed...)
+		} else if symlink {
+			logrus.Infof("Duplicate files will be replaced with symlinks")
+			files := sortedByPath(dupFiles)
+			errs := make([]error, len(files))
+			for i, file := range files {
+				sha := dupFiles[file]
+				if cmd.Context().Err() != nil {
+					return interrupted(cmd)
+				}
+				err := symlinkToFile(file.Path, result.Files[sha].Path)
+				if err != nil {
+					errs[i] = err
+					if !skipErrors {
+						break
+					}
+					continue
+				}
+				if err := actions.record("symlink", file.Path, result.Files[sha].Path, sha); err != nil {
+					return err
+				}
+			}
+			failed, err := actionFailures(cmd, files, errs)
+			if err != nil {
+				return err
+			}
+			failures = append(failures, failed...)
 		}
 
 		filenames := make(map[string]int)
+		dirTimes := make(map[string]time.Time)
+		renamed := 0
 		if flatten {
 			logrus.Infof("Non duplicate files will be flatten in %v", fdir)
-			for _, file := range files {
-
-				// so at this point we have unique files but the names
-				// could be duplicated so we'll make them unique
-				flattenFilename := filepath.Base(file.Path)
-				if x, has := filenames[flattenFilename]; has {
-					flattenFilename = fmt.Sprint(flattenFilename, x)
-					filenames[flattenFilename]++
-				} else {
-					filenames[flattenFilename] = 1
+			// so at this point we have unique files but the names
+			// could be duplicated so we'll make them unique, before the
+			// workers start so the names don't depend on their order
+			done.reserveMoved(fdir, filenames, caseInsensitiveNames)
+			files := flattenFiles(result, dupFiles)
+			names := make([]string, len(files))
+			for i, file := range files {
+				name := filepath.Join(keptDirs(file.Path, args, flattenKeepDepth), filepath.Base(file.Path))
+				names[i] = flattenName(name, filenames, caseInsensitiveNames)
+				if names[i] != name {
+					renamed++
 				}
+			}
 
-				if remove {
-					moveToDirectory(file.Path, fdir, flattenFilename)
-				} else {
-					copyToDirectory(file.Path, fdir, flattenFilename)
+			action, apply := "copy", copyToDirectory
+			if remove {
+				action, apply = "move", moveToDirectory
+			}
+			files, names = done.notDone(action, files, names, fdir)
+			errs := runParallel(cmd.Context(), len(files), func(i int) error {
+				if err := apply(files[i].Path, fdir, names[i]); err != nil {
+					return err
+				}
+				return actions.record(action, files[i].Path, destinationPath(files[i].Path, fdir, names[i]), "")
+			})
+			for i, file := range files {
+				if errs[i] == nil {
+					noteDirTime(dirTimes, fdir, names[i], file.Time)
 				}
 			}
+			if preserveDirTimes && !dryrun {
+				restoreDirTimes(dirTimes)
+			}
+			if cmd.Context().Err() != nil {
+				return interrupted(cmd)
+			}
+			failed, err := actionFailures(cmd, files, errs)
+			if err != nil {
+				return err
+			}
+			failures = append(failures, failed...)
+		}
+
+		printErrors(result)
+		printFailures(failures)
+		if !quiet {
+			if dryrun {
+				printDryrunSummary(os.Stdout, result, renamed)
+			} else {
+				printSummary(result)
+			}
+			printStats(os.Stdout, result)
+		}
+		if len(failures) > 0 {
+			cmd.SilenceUsage = true
+			return ioError{fmt.Errorf("%v files couldn't be changed", len(failures))}
 		}
 		return nil
 	},
 }
 
-func copyToDirectory(filename string, destinationDir string, newFilename string) error {
-	full := filepath.Join(destinationDir, filename)
+// withSimilar returns the duplicates of result along with the images that
+// are only similar to the one kept in their group, which map to the empty
+// hash.
+func withSimilar(result *dedup.Result) map[dedup.PathTime]string {
+	dupFiles := make(map[dedup.PathTime]string, len(result.Duplicates))
+	for file, sha := range result.Duplicates {
+		dupFiles[file] = sha
+	}
+	for _, group := range result.Similar {
+		for _, file := range group.Duplicates {
+			dupFiles[file] = ""
+		}
+	}
+	return dupFiles
+}
+
+// outsideArchives returns the files in dupFiles that aren't inside an
+// archive, archives are only read so their members are left alone.
+func outsideArchives(result *dedup.Result, dupFiles map[dedup.PathTime]string) map[dedup.PathTime]string {
+	if len(result.ArchiveMembers) == 0 {
+		return dupFiles
+	}
+	outside := make(map[dedup.PathTime]string, len(dupFiles))
+	for file, sha := range dupFiles {
+		if !result.ArchiveMembers[file] {
+			outside[file] = sha
+		}
+	}
+	return outside
+}
+
+// outsideSameDir returns the files in dupFiles that have no copy in the
+// same directory, copies next to each other are probably intentional.
+func outsideSameDir(result *dedup.Result, dupFiles map[dedup.PathTime]string) map[dedup.PathTime]string {
+	outside := make(map[dedup.PathTime]string, len(dupFiles))
+	for file, sha := range dupFiles {
+		copies := 0
+		for _, member := range result.Members[sha] {
+			if filepath.Dir(member.Path) == filepath.Dir(file.Path) {
+				copies++
+			}
+		}
+		if copies > 1 {
+			logrus.Infof("Found: %v : copy in the same directory, leaving it", file.Path)
+			continue
+		}
+		outside[file] = sha
+	}
+	return outside
+}
+
+// printPairs prints each file in dupFiles with the file kept over it, so the
+// --keep decisions can be checked.
+func printPairs(w io.Writer, result *dedup.Result, dupFiles map[dedup.PathTime]string) {
+	similarTo := make(map[dedup.PathTime]dedup.PathTime)
+	for _, group := range result.Similar {
+		for _, file := range group.Duplicates {
+			similarTo[file] = group.Kept
+		}
+	}
+	for _, file := range sortedByPath(dupFiles) {
+		if sha := dupFiles[file]; sha != "" {
+			fmt.Fprintf(w, "DUPLICATE %v -> KEEP %v\n", file.Path, result.Files[sha].Path)
+		} else {
+			fmt.Fprintf(w, "SIMILAR %v -> KEEP %v\n", file.Path, similarTo[file].Path)
+		}
+	}
+}
+
+// sortedByPath returns the files in dupFiles sorted by path, so the files are
+// acted on in the same order every run.
+func sortedByPath(dupFiles map[dedup.PathTime]string) []dedup.PathTime {
+	files := make([]dedup.PathTime, 0, len(dupFiles))
+	for file := range dupFiles {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// flattenFiles returns the unique files to flatten. Reference files are
+// already in the library they reference so only the files new to it are
+// flattened, and images removed by --fuzzy-delete, files inside archives and
+// files that changed while they were hashed are left out.
+func flattenFiles(result *dedup.Result, dupFiles map[dedup.PathTime]string) []dedup.PathTime {
+	files := make([]dedup.PathTime, 0, len(result.Unique)+len(result.Files))
+	for _, file := range result.UniqueFiles() {
+		if _, removed := dupFiles[file]; removed || result.References[file] || result.ArchiveMembers[file] || result.Changed[file] {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// keptDirs returns the first depth directories of path below the input
+// directory it is in, which are kept when it is flattened.
+func keptDirs(path string, roots []string, depth int) string {
+	rel := filepath.Clean(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		for _, root := range roots {
+			root, err := filepath.Abs(root)
+			if err != nil {
+				continue
+			}
+			if r, err := filepath.Rel(root, abs); err == nil && r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+				rel = r
+				break
+			}
+		}
+	}
+	rel = strings.TrimPrefix(rel, filepath.VolumeName(rel))
+
+	dirs := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	kept := make([]string, 0, depth)
+	for _, dir := range dirs {
+		if len(kept) == depth {
+			break
+		}
+		if dir != "" && dir != "." {
+			kept = append(kept, dir)
+		}
+	}
+	return filepath.Join(kept...)
+}
+
+// noteDirTime records t in times for fdir and every directory below it that
+// the flattened file name is in, if it is newer than what they have.
+func noteDirTime(times map[string]time.Time, fdir string, name string, t time.Time) {
+	dir := filepath.Dir(filepath.Join(fdir, name))
+	for {
+		if old, has := times[dir]; !has || t.After(old) {
+			times[dir] = t
+		}
+		if rel, err := filepath.Rel(fdir, dir); err != nil || rel == "." {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// restoreDirTimes sets the access and modification times of each directory in
+// times, deepest first since setting them doesn't touch the parent.
+func restoreDirTimes(times map[string]time.Time) {
+	dirs := make([]string, 0, len(times))
+	for dir := range times {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+	for _, dir := range dirs {
+		if err := os.Chtimes(dir, times[dir], times[dir]); err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+// flattenName returns name if it hasn't been used yet, otherwise it returns
+// name renamed by --flatten-suffix with the lowest counter that hasn't been
+// used, by default e.g. name.jpg, name_1.jpg, name_2.jpg. used maps each name
+// already taken to the next counter to try for it and is updated with the
+// result. With foldCase names differing only in case are the same name, as
+// they are on case-insensitive file systems.
+func flattenName(name string, used map[string]int, foldCase bool) string {
+	key := func(name string) string {
+		if foldCase {
+			return strings.ToLower(name)
+		}
+		return name
+	}
+
+	if _, has := used[key(name)]; !has {
+		used[key(name)] = 1
+		return name
+	}
+
+	dir, base := filepath.Split(name)
+	stem, ext := splitExt(base)
+	for {
+		unique := dir + strings.NewReplacer("{name}", stem, "{n}", strconv.Itoa(used[key(name)]), "{ext}", ext).Replace(flattenSuffix)
+		used[key(name)]++
+		if _, has := used[key(unique)]; !has {
+			used[key(unique)] = 1
+			return unique
+		}
+	}
+}
+
+// splitExt splits the file name base into its stem and extension, which
+// includes the dot. Names starting with a dot such as .bashrc have no
+// extension, and compressed tarballs keep .tar, e.g. .tar.gz.
+func splitExt(base string) (string, string) {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" || strings.Trim(stem, ".") == "" {
+		return base, ""
+	}
+	if tar := filepath.Ext(stem); strings.EqualFold(tar, ".tar") && strings.TrimSuffix(stem, tar) != "" {
+		return strings.TrimSuffix(stem, tar), tar + ext
+	}
+	return stem, ext
+}
+
+// confirm asks the user whether the files in dupFiles should be (re)moved,
+// reading the answer from in. Anything other than y or yes is a no.
+func confirm(in io.Reader, dupFiles map[dedup.PathTime]string) (bool, error) {
+	action := "removed"
+	if ddup {
+		action = "moved to " + ddir
+	}
+	var size int64
+	for file := range dupFiles {
+		size += file.Size
+	}
+	fmt.Printf("%v duplicate files totaling %v will be %v.\nProceed? [y/N] ", formatCount(len(dupFiles)), formatBytes(size), action)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// checkSpace returns an error if the filesystem dir will be created on
+// doesn't have size bytes available.
+func checkSpace(dir string, size int64) error {
+	// the directory may not exist yet so check its closest existing parent
+	existing, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := os.Stat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	available, ok, err := freeSpace(existing)
+	if err != nil {
+		return err
+	}
+	if ok && uint64(size) > available {
+		return ioError{fmt.Errorf("not enough space to copy %v to %v, only %v available (use --skip-space-check to copy anyway)", formatBytes(size), dir, formatBytes(int64(available)))}
+	}
+	return nil
+}
+
+// printErrors lists the files skipped because of errors on stderr.
+func printErrors(result *dedup.Result) {
+	if len(result.Errors) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Skipped %v files because of errors:\n", formatCount(len(result.Errors)))
+	for _, e := range result.Errors {
+		fmt.Fprintf(os.Stderr, "  %v\n", e.Err)
+	}
+}
+
+// printSummary prints the number and total size of the duplicate files.
+func printSummary(result *dedup.Result) {
+	fmt.Printf("Found %v duplicate files totaling %v\n", formatCount(len(result.Duplicates)), formatBytes(result.DuplicateSize()))
+	if count, size := similarSize(result); count > 0 {
+		fmt.Printf("Found %v similar images totaling %v\n", formatCount(count), formatBytes(size))
+	}
+}
+
+// printStats prints how much work the scan took when --stats is given.
+func printStats(out io.Writer, result *dedup.Result) {
+	if !showStats {
+		return
+	}
+	stats := result.Stats
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Files scanned:\t%v\n", formatCount(stats.Files))
+	fmt.Fprintf(w, "Files hashed:\t%v\n", formatCount(stats.Hashed))
+	if cache != "" {
+		fmt.Fprintf(w, "Cache hits:\t%v\n", formatCount(stats.CacheHits))
+	}
+	fmt.Fprintf(w, "Bytes read:\t%v\n", formatBytes(stats.BytesRead))
+	fmt.Fprintf(w, "Hashing time:\t%v\n", stats.HashTime.Round(time.Millisecond))
+	if stats.HashTime > 0 {
+		fmt.Fprintf(w, "Throughput:\t%v/s\n", formatBytes(int64(float64(stats.BytesRead)/stats.HashTime.Seconds())))
+	}
+	fmt.Fprintf(w, "Scan time:\t%v\n", stats.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Wall time:\t%v\n", time.Since(started).Round(time.Millisecond))
+	w.Flush()
+}
+
+// similarSize returns the number and total size of the images that are only
+// similar to the one kept in their group.
+func similarSize(result *dedup.Result) (int, int64) {
+	var count int
+	var size int64
+	for _, group := range result.Similar {
+		for _, file := range group.Duplicates {
+			count++
+			size += file.Size
+		}
+	}
+	return count, size
+}
+
+// printDryrunSummary writes a table of what a run without --dryrun would do.
+func printDryrunSummary(out io.Writer, result *dedup.Result, renamed int) {
+	unique := len(result.Unique) + len(result.Files)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DRYRUN summary, nothing was changed")
+	fmt.Fprintf(w, "Files scanned:\t%v\n", formatCount(unique+len(result.Duplicates)))
+	fmt.Fprintf(w, "Unique files:\t%v\n", formatCount(unique))
+	fmt.Fprintf(w, "Duplicate files:\t%v\n", formatCount(len(result.Duplicates)))
+	reclaim := result.DuplicateSize()
+	if count, size := similarSize(result); count > 0 {
+		fmt.Fprintf(w, "Similar images:\t%v\n", formatCount(count))
+		if fuzzyDelete {
+			reclaim += size
+		}
+	}
+	fmt.Fprintf(w, "Bytes to reclaim:\t%v\n", formatBytes(reclaim))
+	if flatten {
+		fmt.Fprintf(w, "Flatten renames:\t%v\n", formatCount(renamed))
+	}
+	w.Flush()
+}
+
+// formatCount returns n with thousands separators such as "4,312".
+func formatCount(n int) string {
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatBytes returns size as a human readable string such as "58.3 GB".
+func formatBytes(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
+
+// strippedPath returns the path of the file at path below prefix, or path
+// itself if prefix is empty or the file isn't under it.
+func strippedPath(path string, prefix string) string {
+	if prefix == "" {
+		return path
+	}
+	absPrefix, err := filepath.Abs(prefix)
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absPrefix, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// destinationPath returns where copyToDirectory and moveToDirectory put
+// filename.
+func destinationPath(filename string, destinationDir string, newFilename string) string {
 	if newFilename != "" {
-		full = filepath.Join(destinationDir, newFilename)
+		return filepath.Join(destinationDir, newFilename)
 	}
+	return filepath.Join(destinationDir, filename)
+}
+
+func copyToDirectory(filename string, destinationDir string, newFilename string) error {
+	full := destinationPath(filename, destinationDir, newFilename)
 
 	logrus.Warnf("Copying %v to %v", filename, full)
 	if dryrun {
 		return nil
 	}
+	// the extended-length forms of the paths work past MAX_PATH on Windows
+	long := dedup.LongPath(full)
 
-	err := os.MkdirAll(filepath.Dir(full), 0755)
+	err := os.MkdirAll(filepath.Dir(long), dirPerm)
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
-	in, err := os.Open(filename)
+	in, err := os.Open(dedup.LongPath(filename))
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	out, err := os.Create(full)
+
+	// copy to a temp file next to the destination and rename it into place
+	// so an interrupted copy never leaves a partial file at full
+	out, err := os.CreateTemp(filepath.Dir(long), "."+filepath.Base(full)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer func() {
-		cerr := out.Close()
-		if err == nil {
-			err = cerr
+	tmp := out.Name()
+	var src io.Reader = in
+	if limitCopies && readLimiter != nil {
+		src = dedup.RateLimitReader(context.Background(), in, readLimiter)
+	}
+	_, err = io.Copy(out, src)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if preserve {
+			err = preserveMetadata(dedup.LongPath(filename), tmp)
+		} else {
+			// temp files are only readable by the owner, use os.Create's usual mode
+			err = os.Chmod(tmp, 0644)
 		}
-	}()
-	if _, err = io.Copy(out, in); err != nil {
+	}
+	if err == nil {
+		err = os.Rename(tmp, long)
+	}
+	if err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	return out.Sync()
+	return nil
 }
 
-func moveToDirectory(filename string, destinationDir string, newFilename string) error {
+// preserveMetadata copies the permissions and access and modification times
+// of the file src to dst.
+func preserveMetadata(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
 
-	full := filepath.Join(destinationDir, filename)
-	if newFilename != "" {
-		full = filepath.Join(destinationDir, newFilename)
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
 	}
+	return os.Chtimes(dst, accessTime(info), info.ModTime())
+}
+
+func moveToDirectory(filename string, destinationDir string, newFilename string) error {
+
+	full := destinationPath(filename, destinationDir, newFilename)
 
 	logrus.Warnf("Moving %v to %v", filename, full)
 	if dryrun {
 		return nil
 	}
+	long := dedup.LongPath(full)
 
-	err := os.MkdirAll(filepath.Dir(full), 0755)
+	err := os.MkdirAll(filepath.Dir(long), dirPerm)
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
-	err = os.Rename(filename, full)
+	err = os.Rename(dedup.LongPath(filename), long)
+	if errors.Is(err, syscall.EXDEV) {
+		// rename can't move across filesystems so copy and remove instead
+		logrus.Infof("%v is on a different filesystem than %v, copying instead", filename, destinationDir)
+		if info, statErr := os.Lstat(dedup.LongPath(filename)); statErr == nil && info.IsDir() {
+			if err := copyTree(filename, full); err != nil {
+				// the source is still whole, don't leave half a copy
+				os.RemoveAll(long)
+				logrus.Error(err)
+				return err
+			}
+			err = os.RemoveAll(dedup.LongPath(filename))
+		} else {
+			if err := copyToDirectory(filename, destinationDir, newFilename); err != nil {
+				return err
+			}
+			err = os.Remove(dedup.LongPath(filename))
+		}
+	}
 	if err != nil {
 		logrus.Error(err)
 		return err
@@ -225,23 +1058,173 @@ func moveToDirectory(filename string, destinationDir string, newFilename string)
 	return nil
 }
 
-func Execute() {
-	err := rootCmd.Execute()
+// copyTree copies the directory src and everything in it to dst, for moving
+// directories across filesystems. Symlinks are copied as symlinks.
+func copyTree(src string, dst string) error {
+	return filepath.WalkDir(dedup.LongPath(src), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dedup.LongPath(src), path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(dedup.LongPath(target), dirPerm)
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dedup.LongPath(target))
+		case entry.Type().IsRegular():
+			return copyToDirectory(path, filepath.Dir(target), filepath.Base(target))
+		}
+		return fmt.Errorf("can't copy %v, it isn't a regular file", path)
+	})
+}
+
+// sameFile reports whether a and b are links to the same data.
+func sameFile(a string, b string) bool {
+	infoA, err := os.Stat(dedup.LongPath(a))
 	if err != nil {
-		os.Exit(1)
+		return false
 	}
+	infoB, err := os.Stat(dedup.LongPath(b))
+	return err == nil && os.SameFile(infoA, infoB)
+}
+
+// errCrossDevice is returned by hardlinkToFile for files it skipped because
+// they are on a different filesystem than the file they'd link to.
+var errCrossDevice = errors.New("on a different filesystem than the kept file")
+
+// hardlinkToFile replaces filename with a hardlink to target. If the two files
+// are on different filesystems filename is left untouched and errCrossDevice
+// is returned.
+func hardlinkToFile(filename string, target string) error {
+	logrus.Warnf("Hardlinking %v to %v", filename, target)
+	if dryrun {
+		return nil
+	}
+
+	// link next to the duplicate first so it is only replaced once the link exists
+	tmp := dedup.LongPath(filename + ".gofilededup-link")
+	err := os.Link(dedup.LongPath(target), tmp)
+	if errors.Is(err, syscall.EXDEV) {
+		logrus.Warnf("Skipping %v: it is on a different filesystem than %v", filename, target)
+		return errCrossDevice
+	}
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	err = os.Rename(tmp, dedup.LongPath(filename))
+	if err != nil {
+		os.Remove(tmp)
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+// symlinkToFile replaces filename with a symlink to the absolute path of target.
+func symlinkToFile(filename string, target string) error {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	logrus.Warnf("Symlinking %v to %v", filename, abs)
+	if dryrun {
+		return nil
+	}
+
+	tmp := dedup.LongPath(filename + ".gofilededup-link")
+	err = os.Symlink(abs, tmp)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	err = os.Rename(tmp, dedup.LongPath(filename))
+	if err != nil {
+		os.Remove(tmp)
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+func Execute() {
+	// stop at the next file on SIGINT or SIGTERM, a second signal kills
+	// the process as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stopTimeout()
+	if err == nil {
+		err = writeSinceFile()
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+	summary.flush()
+	os.Exit(exitCode(err))
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "warn", "Log level: debug, info, warn or error.")
+	rootCmd.PersistentFlags().DurationVar(&logSummaryInterval, "log-summary", 0, "Instead of a line per file, count the messages below error level and log how many there were and how many files were hashed every this long, e.g. 10s. --log-summary alone is every 10s. 0 logs every message.")
+	rootCmd.PersistentFlags().Lookup("log-summary").NoOptDefVal = "10s"
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only output errors, same as --log-level error without the progress and summary.")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML, TOML or JSON file setting any flag by its name. Flags given on the command line and GOFILEDEDUP_ environment variables, e.g. GOFILEDEDUP_DDIR, take precedence.")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Stop after this long, e.g. 30m, printing what was found so far and exiting with code 4. Files already being moved or removed are finished first. 0 means no limit.")
+
 	rootCmd.Flags().BoolVar(&dryrun, "dryrun", false, "Sets to do a dryrun before running for real")
+	rootCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Ask which file of each group of duplicates to keep, suggesting the one --keep would, or to skip the group. Replaces the confirmation of --rdup.")
+	rootCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation before removing or moving duplicate files.")
+	rootCmd.Flags().BoolVar(&skipSpaceCheck, "skip-space-check", false, "Don't check there is enough free space before copying files to --ddir or --fdir.")
+	addScanFlags(rootCmd.Flags())
+	addReportFlags(rootCmd.Flags())
 
-	rootCmd.Flags().StringVar(&ddir, "ddir", "./dupdump", "Directory to copy duplicate files into, it will retain the relative filepath.")
+	rootCmd.Flags().StringVar(&ddir, "ddir", "./dupdump", "Directory to copy duplicate files into, by default it will retain the relative filepath, see --ddir-layout.")
 	rootCmd.MarkFlagDirname("ddir")
-	rootCmd.Flags().BoolVar(&dedup, "dedup", false, "Enable saving a copy of the duplicates to the --ddir directory.")
+	rootCmd.Flags().BoolVar(&dumpManifest, "dedup-output-manifest", false, "With --dedup write "+dumpManifestName+" to --ddir listing the original path of each file copied or moved into it, where it is in --ddir, its hash and the file kept that it duplicates. Runs into the same --ddir add to it.")
+	rootCmd.Flags().StringVar(&dirMode, "dir-mode", "0755", "Octal permissions of the directories created in --ddir and --fdir, less the umask.")
+	rootCmd.Flags().StringVar(&stripPrefix, "strip-prefix", "", "With the mirror --ddir-layout remove this leading directory from the paths reproduced in --ddir, e.g. /mnt/bigdisk so they start at the folders below it. Files outside it keep their whole path.")
+	cobra.MarkFlagDirname(rootCmd.Flags(), "strip-prefix")
+	rootCmd.Flags().StringVar(&ddirLayout, "ddir-layout", "mirror", "How duplicates are laid out in --ddir: mirror keeps their relative filepath, flat puts them all directly in it with a counter added to clashing names.")
+	rootCmd.Flags().BoolVar(&ddup, "dedup", false, "Enable saving a copy of the duplicates to the --ddir directory.")
+	rootCmd.Flags().StringVar(&leaveSymlink, "leave-symlink", "", "With --dedup and --rdup leave a symlink behind where each duplicate was, pointing at its copy in --ddir (ddir) or at the file kept (kept).")
 	rootCmd.Flags().BoolVar(&rdup, "rdup", false, "When enabled all duplicate files in input directory will be removed.")
+	rootCmd.Flags().BoolVar(&fuzzyDelete, "fuzzy-delete", false, "With --rdup also remove the images that are only similar to the one kept, see --similarity-threshold. Similar images can differ, so check them with the scan subcommand first.")
+	rootCmd.Flags().BoolVar(&excludeSameDir, "exclude-same-dir", false, "Leave duplicates that have a copy in the same directory alone, they are only reported.")
+	rootCmd.Flags().BoolVar(&actByName, "act-by-name", false, "Allow --dedup, --rdup, --hardlink, --symlink and --flatten with --by-name or --by-name-size, acting on files that may have different content.")
+	rootCmd.Flags().StringVar(&journalFile, "journal", "", "Append a CSV row of the action, source, destination, hash and time to this file for every file copied, moved, removed or linked, see the undo subcommand and --resume.")
+	rootCmd.Flags().BoolVar(&resume, "resume", false, "Skip the copies and moves to --ddir and --fdir already recorded in --journal, to carry on after an interrupted run.")
+	rootCmd.Flags().BoolVar(&trash, "trash", false, "When used with --rdup duplicate files are moved to the trash instead of being removed.")
+
+	rootCmd.Flags().BoolVar(&hardlink, "hardlink", false, "When enabled all duplicate files in input directory will be replaced with a hardlink to the file they duplicate. Files that already are hardlinks of each other aren't duplicates unless --follow-hardlinks-as-unique is given.")
+	rootCmd.Flags().BoolVar(&symlink, "symlink", false, "When enabled all duplicate files in input directory will be replaced with a symlink to the file they duplicate.")
 
 	rootCmd.Flags().StringVar(&fdir, "fdir", "./flatten", "Directory to copy all files with flattened relative directories into.")
 	rootCmd.MarkFlagDirname("fdir")
+	rootCmd.Flags().IntVar(&actionWorkers, "action-workers", 1, "Number of files to copy or move to --ddir and --fdir in parallel, more can be faster when they go to another disk.")
+	rootCmd.Flags().BoolVar(&limitCopies, "limit-copies", false, "Also limit reading the files copied to --ddir and --fdir to --max-read-rate, sharing the limit with hashing.")
+	rootCmd.Flags().BoolVar(&preserve, "preserve", true, "Preserve the permissions and access and modification times of copied files.")
+	rootCmd.Flags().BoolVar(&preserveDirTimes, "preserve-dir-times", false, "Set the times of the directories created in --fdir to the newest modification time of the files flattened into them.")
+	rootCmd.Flags().StringVar(&flattenSuffix, "flatten-suffix", "{name}_{n}{ext}", "How files whose name is taken are renamed when flattening and with the flat --ddir-layout, {name} is the name without its extension, {n} the lowest counter from 1 that makes it unique and {ext} the extension such as .jpg or .tar.gz.")
+	rootCmd.Flags().IntVar(&flattenKeepDepth, "flatten-keep-depth", 0, "Keep this many leading directories of each file's path below its input directory when flattening, e.g. 1 flattens each top level directory separately.")
+	rootCmd.Flags().BoolVar(&caseInsensitiveNames, "case-insensitive-names", runtime.GOOS == "windows" || runtime.GOOS == "darwin", "Treat flattened names that only differ in case as colliding, as they do on case-insensitive file systems. Defaults to true on Windows and macOS.")
 	rootCmd.Flags().BoolVar(&flatten, "flatten", false, "Enable saving off the all non duplicated files to the --fdir directory.")
 	rootCmd.Flags().BoolVar(&remove, "remove", false, "When enabled all non-duplicate files in input directory will be removed.")
 
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// runRoot runs the root command with args, with every other flag at its
+// default.
+func runRoot(t *testing.T, args ...string) {
+	t.Helper()
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	rootCmd.Flags().VisitAll(reset)
+	rootCmd.PersistentFlags().VisitAll(reset)
+
+	rootCmd.SetArgs(args)
+	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlattenName(t *testing.T) {
+	paths := []string{
+		filepath.Join("in", "a", "photo.jpg"),
+		filepath.Join("in", "b", "photo.jpg"),
+		filepath.Join("in", "c", "photo.jpg"),
+		filepath.Join("in", "c", "d", "photo.jpg"),
+		filepath.Join("in", "e", "photo_1.jpg"),
+		filepath.Join("in", "f", "backup.tar.gz"),
+		filepath.Join("in", "g", "backup.tar.gz"),
+	}
+	want := []string{"photo.jpg", "photo_1.jpg", "photo_2.jpg", "photo_3.jpg", "photo_1_1.jpg", "backup.tar.gz", "backup_1.tar.gz"}
+
+	for run := 0; run < 3; run++ {
+		used := make(map[string]int)
+		seen := make(map[string]bool)
+		for i, path := range paths {
+			got := flattenName(filepath.Base(path), used, false)
+			if got != want[i] {
+				t.Errorf("run %v: flattenName(%q) = %q, want %q", run, path, got, want[i])
+			}
+			if seen[got] {
+				t.Errorf("run %v: %q was returned twice", run, got)
+			}
+			seen[got] = true
+		}
+	}
+}
+
+func TestFlattenNameFoldCase(t *testing.T) {
+	used := make(map[string]int)
+	got := []string{
+		flattenName("IMG.JPG", used, true),
+		flattenName("img.jpg", used, true),
+		flattenName("Img.jpg", used, true),
+	}
+	want := []string{"IMG.JPG", "img_1.jpg", "Img_2.jpg"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("name %v = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRdupNested(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		filepath.Join("a", "x.txt"):                "same",
+		filepath.Join("a", "b", "c", "x.txt"):      "same",
+		filepath.Join("a", "b", "c", "d", "z.txt"): "same",
+		filepath.Join("a", "b", "y.txt"):           "unique",
+	}
+	old := time.Now().Add(-time.Hour)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the oldest is kept
+	if err := os.Chtimes(filepath.Join(dir, "a", "x.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	runRoot(t, "--rdup", "--yes", "--quiet", dir)
+
+	for name, kept := range map[string]bool{
+		filepath.Join("a", "x.txt"):                true,
+		filepath.Join("a", "b", "c", "x.txt"):      false,
+		filepath.Join("a", "b", "c", "d", "z.txt"): false,
+		filepath.Join("a", "b", "y.txt"):           true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept && err != nil {
+			t.Errorf("%v was removed: %v", name, err)
+		}
+		if !kept && err == nil {
+			t.Errorf("%v wasn't removed", name)
+		}
+	}
+}
+
+func TestFlattenStable(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	for i := 0; i < 40; i++ {
+		// same-named files that differ, and some duplicates
+		path := filepath.Join(in, fmt.Sprintf("d%v", i%7), fmt.Sprintf("s%v", i), "photo.jpg")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("photo %v", i%29)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the action, source and name in --fdir of every journaled copy
+	var first [][]string
+	for run := 0; run < 3; run++ {
+		fdir := filepath.Join(dir, fmt.Sprintf("flat%v", run))
+		journal := filepath.Join(dir, fmt.Sprintf("journal%v.csv", run))
+		runRoot(t, "--flatten", "--fdir", fdir, "--workers", "8", "--journal", journal, "--quiet", in)
+
+		f, err := os.Open(journal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			name, err := filepath.Rel(fdir, row[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			actions = append(actions, []string{row[0], row[1], name})
+		}
+
+		if run == 0 {
+			first = actions
+			if len(actions) != 29 {
+				t.Fatalf("got %v files flattened, want 29", len(actions))
+			}
+			continue
+		}
+		if !reflect.DeepEqual(actions, first) {
+			t.Errorf("run %v flattened\n%v\nthe first run\n%v", run, actions, first)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+)
+
+var workers int
+var bufferSize int
+var mmapThreshold int64
+var hashName string
+var verify bool
+var includes []string
+var excludes []string
+var excludeDirs []string
+var matchRegex []string
+var ignoreRegex []string
+var newerThan string
+var olderThan string
+var sinceFile string
+
+// scanned records whether the input directories were scanned, which is when
+// writeSinceFile records the run.
+var scanned bool
+
+var cache string
+var keep string
+var mtimeTolerance time.Duration
+var preferDir string
+var references []string
+var skipHidden bool
+var skipAppleDouble bool
+var includeEmpty bool
+var scanArchives bool
+var byName bool
+var byNameSize bool
+var dedupWithin int
+var maxReadRate string
+var hashOffset int64
+var hashLength int64
+
+// readLimiter limits reading files to --max-read-rate, nil without it.
+var readLimiter *rate.Limiter
+var exifDedup bool
+var normalizeText bool
+var maxDepth int
+var noRecurse bool
+var similarityThreshold int
+var skipErrors bool
+var followSymlinks bool
+var hardlinksAsUnique bool
+var quickHash bool
+var fromStdin bool
+var nullSeparated bool
+var printJSON bool
+var printUnique bool
+var failOnDuplicates bool
+var showStats bool
+
+var scanCmd = &cobra.Command{
+	Use:   "scan INPUT_DIR...",
+	Short: "Report duplicate files without changing anything.",
+	Long: `Report duplicate files without changing anything.
+		Each group of duplicates is printed with the file that would be kept first.
+	`,
+	Args: inputArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if top < 0 {
+			return fmt.Errorf("--top must not be negative")
+		}
+		result, err := scanInputs(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		if err := writeReports(result); err != nil {
+			return err
+		}
+
+		if printJSON {
+			data, err := reportJSON(result)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if printUnique {
+			separator := "\n"
+			if nullSeparated {
+				separator = "\x00"
+			}
+			for _, file := range result.UniqueFiles() {
+				fmt.Print(file.Path, separator)
+			}
+			printErrors(result)
+			return nil
+		}
+
+		for _, group := range topGroups(result.Groups(), top) {
+			fmt.Printf("%v %v\n", group.Hash, formatBytes(group.Kept.Size))
+			fmt.Printf("  keep %v\n", group.Kept.Path)
+			for _, file := range group.Duplicates {
+				fmt.Printf("  dup  %v\n", file.Path)
+			}
+		}
+		for _, group := range result.Similar {
+			fmt.Printf("similar %v\n", group.Hash)
+			fmt.Printf("  keep %v\n", group.Kept.Path)
+			for _, file := range group.Duplicates {
+				fmt.Printf("  like %v\n", file.Path)
+			}
+		}
+		printErrors(result)
+		if !quiet {
+			printSummary(result)
+			printStats(os.Stdout, result)
+		}
+		return nil
+	},
+}
+
+// inputArgs requires at least one input directory, or none with --from-stdin.
+func inputArgs(cmd *cobra.Command, args []string) error {
+	if fromStdin {
+		return cobra.NoArgs(cmd, args)
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+// addScanFlags adds the flags controlling how duplicates are found to flags.
+func addScanFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&hashName, "hash", "sha256", "Hash used to compare files: sha256, sha1, md5, blake2b or xxhash.")
+	flags.Int64Var(&hashOffset, "hash-offset", 0, "Only hash the bytes of each file from this offset on, e.g. to skip headers that differ. Files that end at or before it are skipped.")
+	flags.Int64Var(&hashLength, "hash-length", 0, "Only hash this many bytes of each file from --hash-offset on. 0 hashes to the end of the file.")
+	flags.BoolVar(&quickHash, "quick-hash", false, "Fingerprint files by their size and first and last 64KB first, only files with matching fingerprints are fully hashed. There's no extra risk of false duplicates.")
+	flags.BoolVar(&byName, "by-name", false, "Treat files with the same name as duplicates without reading them, as a quick check for re-downloads. Their content can differ so nothing is changed unless --act-by-name is given too.")
+	flags.BoolVar(&byNameSize, "by-name-size", false, "Like --by-name but files must also have the same size, a quick way to find likely duplicates on slow shares before hashing them.")
+	flags.IntVar(&dedupWithin, "dedup-within", 0, "Only treat files as duplicates of files in the same directory this many levels below the input directory, --dedup-within alone dedups each top level directory on its own. 0 dedups across everything.")
+	flags.Lookup("dedup-within").NoOptDefVal = "1"
+	flags.BoolVar(&exifDedup, "exif-dedup", false, "Compare JPEG, PNG and GIF images by their decoded pixels instead of their bytes, so copies that only differ in metadata such as EXIF are duplicates.")
+	flags.BoolVar(&normalizeText, "normalize-text", false, "Compare text files such as .txt, .md, .csv and source code by their text with LF line endings and without trailing whitespace or blank lines at the end, so copies that only differ in those are duplicates. Files with NUL bytes are compared byte for byte.")
+	flags.IntVar(&similarityThreshold, "similarity-threshold", -1, "Also report images whose perceptual hashes differ in at most this many of their 64 bits as similar, e.g. resized or recompressed copies. -1 disables it.")
+	flags.BoolVar(&fromStdin, "from-stdin", false, "Read the newline separated files to dedup from stdin instead of walking input directories.")
+	flags.BoolVarP(&nullSeparated, "null", "0", false, "Separate file lists read and written with NUL instead of newlines, like find -print0 and xargs -0.")
+	flags.StringVar(&keep, "keep", "oldest", "Which duplicate is kept: oldest, newest, shortest-path, longest-path, shortest-name or first-seen. Ties are broken by the oldest, then the shortest path, then the path that sorts first.")
+	flags.DurationVar(&mtimeTolerance, "mtime-tolerance", 0, "Treat modification times less than this apart as equal when choosing which duplicate is kept, for filesystems with coarse times such as FAT. Equal times fall back to the shortest path, then the path that sorts first.")
+	flags.StringVar(&preferDir, "prefer-dir", "", "Always keep the duplicate under this directory, overriding --keep.")
+	cobra.MarkFlagDirname(flags, "prefer-dir")
+	flags.StringArrayVar(&references, "reference", nil, "Directory of reference files that are never changed, files elsewhere with the same content are duplicates of them and --flatten only flattens files new to them. Can be repeated.")
+	cobra.MarkFlagDirname(flags, "reference")
+	flags.BoolVar(&verify, "verify", false, "Compare the content of files with matching hashes byte by byte before treating them as duplicates.")
+	flags.StringArrayVar(&includes, "include", nil, "Only dedup files whose name matches this glob pattern, can be repeated.")
+	flags.StringArrayVar(&excludes, "exclude", nil, "Skip files whose name matches this glob pattern, can be repeated.")
+	flags.StringArrayVar(&excludeDirs, "exclude-dir", nil, "Skip directories matching this glob pattern without descending into them, e.g. node_modules. Patterns with a separator match the path below the input directory. Can be repeated. The trash is always skipped.")
+	flags.StringArrayVar(&matchRegex, "match-regex", nil, "Only dedup files whose path, with forward slashes, matches this regular expression, can be repeated.")
+	flags.StringArrayVar(&ignoreRegex, "ignore-regex", nil, "Skip files whose path, with forward slashes, matches this regular expression, and directories whose path followed by a slash does, e.g. '(?i)/thumbnails?/'. Can be repeated.")
+	flags.StringVar(&newerThan, "newer-than", "", "Only dedup files modified after this time, either a duration ago such as 30d or 12h, or an RFC3339 time or date such as 2024-01-31.")
+	flags.StringVar(&olderThan, "older-than", "", "Only dedup files modified before this time, either a duration ago such as 30d or 12h, or an RFC3339 time or date such as 2024-01-31.")
+	flags.StringVar(&sinceFile, "since-file", "", "Only dedup files modified since the last successful run with this file, which records when it started. The first run, while the file doesn't exist, dedups everything. Older files aren't compared with, add them with --reference to dedup new files against them.")
+	flags.StringVar(&cache, "cache", "", "File used to cache hashes between runs, files with unchanged size and modification time are not rehashed.")
+	flags.StringVar(&loadSumFile, "load-sumfile", "", "Use the hashes in this sha256sum style checksum file, e.g. one written by --sumfile, for the files it lists instead of hashing them. They must be of the files as they are now and made with --hash.")
+	flags.BoolVar(&showStats, "stats", false, "Print the number of files and bytes hashed, cache hits, hashing throughput and how long the run took at the end.")
+	flags.BoolVar(&showProgress, "progress", false, "Show the hashing progress on stderr, disabled when stdout is not a terminal.")
+	flags.BoolVar(&skipHidden, "skip-hidden", false, "Skip hidden files and directories.")
+	flags.BoolVar(&skipAppleDouble, "skip-appledouble", false, "Skip the ._ files macOS leaves next to files copied to other file systems, holding their resource forks and extended attributes.")
+	flags.BoolVar(&includeEmpty, "include-empty", false, "Dedup empty files instead of skipping them, they all hash the same so only one is kept.")
+	flags.BoolVar(&scanArchives, "scan-archives", false, "Also dedup the files inside .zip, .tar, .tar.gz and .tgz archives, named like archive.zip!dir/file. Archives are only read, a duplicate inside one is reported but never changed.")
+	flags.IntVar(&maxDepth, "max-depth", -1, "Only walk this many directories below each input directory, 0 is just the files directly in it. -1 means no limit.")
+	flags.BoolVar(&noRecurse, "no-recurse", false, "Only dedup the files directly in each input directory, same as --max-depth 0.")
+	flags.BoolVar(&followSymlinks, "follow-symlinks", false, "Descend into symlinked directories, each directory is only walked once.")
+	flags.BoolVar(&hardlinksAsUnique, "follow-hardlinks-as-unique", false, "Treat each hardlink as a file of its own so links to the same data are reported as duplicates, instead of as one file. Removing such a duplicate frees no space, and --hardlink leaves files that are already links to the kept file alone, so a later run without this flag won't report them again.")
+	flags.BoolVar(&skipErrors, "skip-errors", false, "Skip files that can't be read, or copied, moved, removed or linked such as when a directory can't be created for them, instead of stopping. They are listed at the end.")
+	flags.StringVar(&maxReadRate, "max-read-rate", "", "Limit how fast files are read for hashing, e.g. 50MB/s, so a shared disk isn't saturated. See --limit-copies.")
+	flags.IntVar(&workers, "workers", runtime.NumCPU(), "Number of files to hash in parallel.")
+	flags.Int64Var(&mmapThreshold, "mmap-threshold", 0, "Memory map files of at least this many bytes to hash them instead of reading them, e.g. 67108864 (64MB). Only use it on files that aren't being changed. 0 disables it.")
+	flags.IntVar(&bufferSize, "buffer-size", dedup.DefaultBufferSize, fmt.Sprintf("Size in bytes of the buffer each worker reads files into, at most %v. Larger buffers such as 1048576 (1MB) are faster on spinning disks.", dedup.MaxBufferSize))
+}
+
+// addReportFlags adds the flags for writing reports of the duplicates to flags.
+func addReportFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&failOnDuplicates, "fail-on-duplicates", false, "Print each group of duplicates on a line to stderr, for checks in CI that fail when there are any. Runs that find duplicates always exit with 1, see the README.")
+	flags.StringVar(&report, "report", "", "Write a JSON report of the duplicate groups to this file.")
+	flags.StringVar(&csvFile, "csv", "", "Write a CSV file with the hash, size, status (kept or duplicate) and path of every hashed file.")
+	flags.StringVar(&sumFile, "sumfile", "", "Write the hash and path of every hashed file to this file in the format of sha256sum, or of sha1sum, md5sum and so on for the other --hash values, to check them with sha256sum -c. Files with a unique size aren't hashed so aren't listed.")
+	flags.StringVar(&htmlReport, "html-report", "", "Write a self-contained HTML page to this file listing the duplicate groups, with thumbnails of images, to share with people deciding what to delete.")
+}
+
+// scanInputs finds the duplicates in the input directories, or in the files
+// read from stdin with --from-stdin. If the scan is interrupted the partial
+// summary is printed and errInterrupted returned.
+func scanInputs(cmd *cobra.Command, args []string) (*dedup.Result, error) {
+	for _, arg := range args {
+		if _, err := os.Stat(arg); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("input directory to deduplicate file must exist: %v", arg)
+		}
+	}
+
+	d, err := newDeduplicator()
+	if err != nil {
+		return nil, err
+	}
+
+	var result *dedup.Result
+	if fromStdin {
+		var paths []string
+		paths, err = readPaths(os.Stdin)
+		if err == nil {
+			result, err = d.ScanFilesContext(cmd.Context(), paths)
+		}
+	} else {
+		result, err = d.ScanContext(cmd.Context(), args)
+	}
+	if err != nil && cmd.Context().Err() == nil {
+		return nil, scanError(cmd, err)
+	}
+
+	// the hashes found before an interrupt are still worth keeping
+	if cache != "" {
+		if err := d.Cache.Save(cache); err != nil {
+			return nil, err
+		}
+	}
+
+	if err != nil {
+		err := interrupted(cmd)
+		logrus.Warnf("Scan %v, no files were changed", err)
+		printErrors(result)
+		if !quiet {
+			printSummary(result)
+			printStats(os.Stdout, result)
+		}
+		return nil, err
+	}
+	foundDuplicates = len(result.Duplicates) > 0
+	if failOnDuplicates {
+		printOffending(os.Stderr, result)
+	}
+	scanned = true
+	return result, nil
+}
+
+// newDeduplicator returns a Deduplicator configured by the scan flags.
+func newDeduplicator() (*dedup.Deduplicator, error) {
+	for _, ref := range references {
+		if info, err := os.Stat(ref); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("reference directory must exist: %v", ref)
+		}
+	}
+
+	if workers < 1 {
+		return nil, fmt.Errorf("workers must be at least 1")
+	}
+
+	if bufferSize < 1 {
+		return nil, fmt.Errorf("buffer size must be at least 1")
+	}
+
+	if noRecurse {
+		if maxDepth > 0 {
+			return nil, fmt.Errorf("--no-recurse can not be used with --max-depth")
+		}
+		maxDepth = 0
+	}
+
+	if maxReadRate != "" {
+		bytesPerSecond, err := parseRate(maxReadRate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --max-read-rate: %w", err)
+		}
+		// a burst of up to a second of reading, capped so the rate stays
+		// smooth when it is high
+		readLimiter = rate.NewLimiter(rate.Limit(bytesPerSecond), int(min(bytesPerSecond, 1024*1024)))
+	}
+
+	matchExpressions, err := compileRegexps(matchRegex)
+	if err != nil {
+		return nil, err
+	}
+	ignoreExpressions, err := compileRegexps(ignoreRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	modifiedAfter, err := parseTime(newerThan)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --newer-than: %w", err)
+	}
+	modifiedBefore, err := parseTime(olderThan)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --older-than: %w", err)
+	}
+	if sinceFile != "" {
+		since, err := readSinceFile(sinceFile)
+		if err != nil {
+			return nil, err
+		}
+		if since.After(modifiedAfter) {
+			modifiedAfter = since
+		}
+	}
+
+	d := &dedup.Deduplicator{
+		Hash:                hashName,
+		Workers:             workers,
+		BufferSize:          bufferSize,
+		MmapThreshold:       mmapThreshold,
+		HashOffset:          hashOffset,
+		HashLength:          hashLength,
+		Verify:              verify,
+		Keep:                keep,
+		MtimeTolerance:      mtimeTolerance,
+		PreferDir:           preferDir,
+		References:          references,
+		Includes:            includes,
+		Excludes:            excludes,
+		ExcludeDirs:         append(trashNames(), excludeDirs...),
+		ExcludePaths:        trashPaths(),
+		MatchRegex:          matchExpressions,
+		IgnoreRegex:         ignoreExpressions,
+		ModifiedAfter:       modifiedAfter,
+		ModifiedBefore:      modifiedBefore,
+		ReadLimiter:         readLimiter,
+		SkipHidden:          skipHidden,
+		SkipAppleDouble:     skipAppleDouble,
+		IncludeEmpty:        includeEmpty,
+		ScanArchives:        scanArchives,
+		ByName:              byName,
+		ByNameSize:          byNameSize,
+		ScopeDepth:          dedupWithin,
+		SkipErrors:          skipErrors,
+		FollowSymlinks:      followSymlinks,
+		SeparateHardlinks:   hardlinksAsUnique,
+		LimitDepth:          maxDepth >= 0,
+		MaxDepth:            maxDepth,
+		QuickHash:           quickHash,
+		ImagePixels:         exifDedup,
+		NormalizeText:       normalizeText,
+		FindSimilar:         similarityThreshold >= 0,
+		SimilarityThreshold: similarityThreshold,
+		OnProgress:          withLogSummary(newProgress()),
+	}
+
+	if cache != "" {
+		c, err := dedup.LoadCache(cache)
+		if err != nil {
+			return nil, err
+		}
+		d.Cache = c
+	}
+
+	if err := checkSumFlags(); err != nil {
+		return nil, err
+	}
+	if loadSumFile != "" {
+		if d.Cache == nil {
+			d.Cache = dedup.NewCache()
+		}
+		if err := loadSums(loadSumFile, d.Cache, hashName); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// printOffending prints each group of duplicates in result to w on one line,
+// the paths separated by =, for --fail-on-duplicates.
+func printOffending(w io.Writer, result *dedup.Result) {
+	groups := result.Groups()
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Found %v groups of duplicate files:\n", formatCount(len(groups)))
+	for _, group := range groups {
+		paths := []string{group.Kept.Path}
+		for _, file := range group.Duplicates {
+			paths = append(paths, file.Path)
+		}
+		fmt.Fprintf(w, "  %v\n", strings.Join(paths, " = "))
+	}
+}
+
+// readSinceFile returns the time stored in the --since-file filename, the
+// zero time if it doesn't exist yet.
+func readSinceFile(filename string) (time.Time, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	since, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v: %w", filename, err)
+	}
+	return since, nil
+}
+
+// writeSinceFile stores when the run started in the --since-file, so the
+// next run skips the files modified before it.
+func writeSinceFile() error {
+	if sinceFile == "" || dryrun || !scanned {
+		return nil
+	}
+	// file systems stamp files with a coarser clock, a file changed just
+	// after the start can look older than it
+	since := started.Add(-time.Second)
+	logrus.Infof("Recording the run in %v", sinceFile)
+	return os.WriteFile(sinceFile, []byte(since.UTC().Format(time.RFC3339Nano)+"\n"), 0644)
+}
+
+// parseTime parses a time given to a flag, either as a duration before now
+// with an optional d suffix for days, or as an RFC3339 time or date. The
+// empty string is the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC3339 time or date", value)
+	}
+	return t, nil
+}
+
+// parseRate parses a rate in bytes per second such as 50MB/s, the units
+// are powers of 1000 like formatBytes, or of 1024 with an i such as MiB/s.
+func parseRate(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.TrimSpace(value), "/s")
+	multiplier := int64(1)
+	for i, prefix := range "kMGT" {
+		upper := strings.ToUpper(string(prefix))
+		if unit, ok := cutAnySuffix(number, string(prefix)+"iB", upper+"iB"); ok {
+			number, multiplier = unit, int64(1)<<(10*(i+1))
+			break
+		}
+		if unit, ok := cutAnySuffix(number, string(prefix)+"B", upper+"B"); ok {
+			number, multiplier = unit, pow1000(i+1)
+			break
+		}
+	}
+	number = strings.TrimSpace(strings.TrimSuffix(number, "B"))
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a positive rate such as 50MB/s", value)
+	}
+	return max(1, int64(n*float64(multiplier))), nil
+}
+
+// cutAnySuffix returns s without the first of suffixes it ends with.
+func cutAnySuffix(s string, suffixes ...string) (string, bool) {
+	for _, suffix := range suffixes {
+		if before, ok := strings.CutSuffix(s, suffix); ok {
+			return before, true
+		}
+	}
+	return s, false
+}
+
+// pow1000 returns 1000 to the power of n.
+func pow1000(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 1000
+	}
+	return p
+}
+
+// compileRegexps compiles the regular expressions given to a flag.
+func compileRegexps(expressions []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expr := range expressions {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// readPaths returns the paths read from in, separated by newlines or by NUL
+// when --null is set.
+func readPaths(in io.Reader) ([]string, error) {
+	paths := make([]string, 0)
+	scanner := bufio.NewScanner(in)
+	if nullSeparated {
+		scanner.Split(scanNull)
+	}
+	for scanner.Scan() {
+		path := scanner.Text()
+		if !nullSeparated {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// scanNull is a bufio.SplitFunc splitting on NUL bytes.
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func init() {
+	addScanFlags(scanCmd.Flags())
+	addReportFlags(scanCmd.Flags())
+	scanCmd.Flags().IntVar(&top, "top", 0, "Only print the N groups of duplicates wasting the most space, the most first. 0 prints them all.")
+	scanCmd.Flags().BoolVar(&printJSON, "json", false, "Print the duplicate groups as JSON instead of text.")
+	scanCmd.Flags().BoolVar(&printUnique, "print-unique", false, "Only print the path of every distinct file, the kept file of each group and every file without duplicates, one per line or NUL separated with -0.")
+	rootCmd.AddCommand(scanCmd)
+}
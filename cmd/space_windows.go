@@ -0,0 +1,17 @@
+package cmd
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the user on the volume
+// containing dir.
+func freeSpace(dir string) (uint64, bool, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, false, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, false, err
+	}
+	return available, true, nil
+}
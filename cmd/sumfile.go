@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nathanhack/gofilededup/dedup"
+	"github.com/sirupsen/logrus"
+)
+
+var sumFile string
+var loadSumFile string
+
+// sumsEscaper escapes the names coreutils escapes in checksum files, whose
+// lines then start with a backslash.
+var sumsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+var sumsUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+
+// checkSumFlags returns an error if --sumfile or --load-sumfile are given
+// with flags that make hashes other than those of the files' bytes.
+func checkSumFlags() error {
+	if sumFile == "" && loadSumFile == "" {
+		return nil
+	}
+	if byName || byNameSize || exifDedup || normalizeText || hashOffset > 0 || hashLength > 0 {
+		return fmt.Errorf("--sumfile and --load-sumfile can not be used with --by-name, --by-name-size, --exif-dedup, --normalize-text, --hash-offset or --hash-length")
+	}
+	return nil
+}
+
+// writeSums writes the hash and path of every hashed file to filename in the
+// format of sha256sum and the other coreutils checksum tools, so it can be
+// checked with sha256sum -c. Files with a unique size aren't hashed so they
+// aren't listed, nor are files inside archives.
+func writeSums(filename string, result *dedup.Result) error {
+	sums := make(map[string]string, len(result.Files)+len(result.Duplicates))
+	for key, file := range result.Files {
+		if !result.ArchiveMembers[file] {
+			sums[file.Path] = key
+		}
+	}
+	for file, key := range result.Duplicates {
+		if !result.ArchiveMembers[file] {
+			sums[file.Path] = key
+		}
+	}
+	paths := make([]string, 0, len(sums))
+	for path := range sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	logrus.Infof("Writing checksums to %v", filename)
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, path := range paths {
+		// keys are scoped with a colon by --dedup-within
+		sha, _, _ := strings.Cut(sums[path], ":")
+		if escaped := sumsEscaper.Replace(path); escaped != path {
+			fmt.Fprintf(w, "\\%v  %v\n", sha, escaped)
+		} else {
+			fmt.Fprintf(w, "%v  %v\n", sha, path)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readSums reads the path and hash of each line of a checksum file written
+// by writeSums or sha256sum, in text or binary mode.
+func readSums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, `\`)
+		if escaped {
+			line = line[1:]
+		}
+		sha, path, ok := strings.Cut(line, " ")
+		if !ok || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return nil, fmt.Errorf("line %v: expected a hash, two spaces and a path", n)
+		}
+		path = path[1:]
+		if escaped {
+			path = sumsUnescaper.Replace(path)
+		}
+		sums[path] = strings.ToLower(sha)
+	}
+	return sums, scanner.Err()
+}
+
+// loadSums adds the hashes in the checksum file filename to cache for the
+// files it lists that still exist, so they aren't hashed again. The hashes
+// are trusted to be of the files as they are now, taken with hashName.
+func loadSums(filename string, cache *dedup.Cache, hashName string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sums, err := readSums(f)
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+
+	h, err := dedup.NewHasher(hashName)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Loading checksums from %v", filename)
+	for path, sha := range sums {
+		if len(sha) != 2*h.Size() {
+			return fmt.Errorf("%v: the hash of %v isn't a %v hash, use the --hash it was made with", filename, path, hashName)
+		}
+		info, err := os.Lstat(dedup.LongPath(path))
+		if err != nil {
+			logrus.Debugf("Skipping checksum of %v: %v", path, err)
+			continue
+		}
+		cache.Put(path, info, hashName, sha)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// canTrash is true since --trash is supported.
+const canTrash = true
+
+// trashNames returns the names of the directories files are trashed into,
+// which aren't scanned.
+func trashNames() []string {
+	return []string{".Trash", ".Trashes"}
+}
+
+// trashPaths returns no paths, the trash in home is found by its name.
+func trashPaths() []string {
+	return nil
+}
+
+// moveToTrash moves filename into the user's ~/.Trash directory, or into
+// .Trashes/$uid at the top of the volume holding it when that isn't the one
+// holding home, since files can't be moved across volumes.
+func moveToTrash(filename string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	trashDir := filepath.Join(home, ".Trash")
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if top := volumeTop(abs, home); top != "" {
+		trashDir = filepath.Join(top, ".Trashes", strconv.Itoa(os.Getuid()))
+		if err := os.MkdirAll(trashDir, 0700); err != nil {
+			return fmt.Errorf("can't trash %v, it is on another volume than %v and its trash can't be created: %w", abs, home, err)
+		}
+	}
+
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	dest := filepath.Join(trashDir, base)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			break
+		}
+		dest = filepath.Join(trashDir, fmt.Sprintf("%v %v%v", strings.TrimSuffix(base, ext), i, ext))
+	}
+	return os.Rename(filename, dest)
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package cmd
+
+import "path/filepath"
+
+// volumeTop returns the top directory of the filesystem holding the file
+// at the absolute path abs when it isn't the one holding home, so it can be
+// trashed on its own filesystem, or "" to use the trash in home.
+func volumeTop(abs string, home string) string {
+	dev, ok := device(abs)
+	if !ok {
+		return ""
+	}
+	if homeDev, ok := device(home); !ok || homeDev == dev {
+		return ""
+	}
+
+	top := filepath.Dir(abs)
+	for {
+		parent := filepath.Dir(top)
+		if parent == top {
+			return top
+		}
+		if parentDev, ok := device(parent); !ok || parentDev != dev {
+			return top
+		}
+		top = parent
+	}
+}
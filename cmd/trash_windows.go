@@ -0,0 +1,21 @@
+package cmd
+
+import "fmt"
+
+// canTrash is false since --trash isn't supported on windows.
+const canTrash = false
+
+// trashNames returns no names since nothing is trashed on windows.
+func trashNames() []string {
+	return nil
+}
+
+// trashPaths returns no paths since nothing is trashed on windows.
+func trashPaths() []string {
+	return nil
+}
+
+// moveToTrash is not supported on windows.
+func moveToTrash(filename string) error {
+	return fmt.Errorf("moving %v to the recycle bin is not supported on windows", filename)
+}
@@ -0,0 +1,134 @@
+//go:build !darwin && !windows
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canTrash is true since --trash is supported.
+const canTrash = true
+
+// trashNames returns the names of the trash directories at the top of
+// filesystems, which aren't scanned.
+func trashNames() []string {
+	return []string{".Trash", ".Trash-" + strconv.Itoa(os.Getuid())}
+}
+
+// trashPaths returns the home trash, which isn't scanned.
+func trashPaths() []string {
+	dir, err := homeTrash()
+	if err != nil {
+		return nil
+	}
+	return []string{dir}
+}
+
+// homeTrash returns the trash in $XDG_DATA_HOME.
+func homeTrash() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash"), nil
+}
+
+// moveToTrash moves filename into the home trash following the
+// freedesktop.org trash specification, or into the trash at the top of its
+// filesystem when that isn't the one holding the home trash, since files
+// can't be moved across filesystems.
+func moveToTrash(filename string) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	trashDir, err := homeTrash()
+	if err != nil {
+		return err
+	}
+	trashedPath := abs
+
+	if err := makeTrash(trashDir); err != nil {
+		return err
+	}
+	if top := volumeTop(abs, trashDir); top != "" {
+		trashDir, err = topTrash(top)
+		if err != nil {
+			return fmt.Errorf("can't trash %v, it is on another filesystem than %v and %w", abs, filepath.Dir(trashDir), err)
+		}
+		// the paths in a trash at the top of a filesystem are relative to it
+		trashedPath, err = filepath.Rel(top, abs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the info file is created exclusively to reserve the name in the trash
+	base := filepath.Base(abs)
+	ext := filepath.Ext(base)
+	name := base
+	var info *os.File
+	for i := 1; ; i++ {
+		info, err = os.OpenFile(filepath.Join(trashDir, "info", name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		name = fmt.Sprintf("%v.%v%v", strings.TrimSuffix(base, ext), i, ext)
+	}
+
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%v\nDeletionDate=%v\n",
+		(&url.URL{Path: trashedPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	if cerr := info.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(abs, filepath.Join(trashDir, "files", name))
+	}
+	if err != nil {
+		os.Remove(filepath.Join(trashDir, "info", name+".trashinfo"))
+		return err
+	}
+	return nil
+}
+
+// makeTrash creates the files and info directories of the trash dir.
+func makeTrash(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0700); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(dir, "info"), 0700)
+}
+
+// topTrash returns the trash of the user at the top directory of a
+// filesystem, creating it if needed. That is top/.Trash/$uid when the
+// administrator created top/.Trash with the sticky bit, otherwise
+// top/.Trash-$uid.
+func topTrash(top string) (string, error) {
+	uid := strconv.Itoa(os.Getuid())
+	shared := filepath.Join(top, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		if err := makeTrash(filepath.Join(shared, uid)); err == nil {
+			return filepath.Join(shared, uid), nil
+		}
+	}
+
+	dir := filepath.Join(top, ".Trash-"+uid)
+	if err := makeTrash(dir); err != nil {
+		return "", fmt.Errorf("its trash can't be created: %w", err)
+	}
+	return dir, nil
+}
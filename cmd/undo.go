@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo JOURNAL",
+	Short: "Reverse the actions recorded in a --journal file.",
+	Long: `Reverse the actions recorded in a --journal file, newest first.
+		Moved files are moved back, replacing the symlink --leave-symlink left in their
+		place if it wasn't changed since, copies are removed and hardlinks and symlinks
+		are replaced with a copy of the file they point to.
+		Removed and trashed files can't be restored, they are listed instead.
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = 5
+		rows, err := r.ReadAll()
+		if err != nil {
+			return err
+		}
+
+		// the symlinks --leave-symlink left where files were moved from
+		links := make(map[string]string)
+		for _, row := range rows {
+			if row[0] == "leave-symlink" {
+				links[row[1]] = row[2]
+			}
+		}
+
+		undone, failed := 0, 0
+		for i := len(rows) - 1; i >= 0; i-- {
+			action, source, destination := rows[i][0], rows[i][1], rows[i][2]
+
+			var err error
+			switch action {
+			case "move":
+				if leftSymlink(source, links) {
+					if err := os.Remove(source); err != nil {
+						logrus.Error(err)
+						failed++
+						continue
+					}
+				}
+				if _, err := os.Lstat(source); err == nil {
+					logrus.Errorf("Can't move %v back, %v exists", destination, source)
+					failed++
+					continue
+				}
+				err = moveToDirectory(destination, filepath.Dir(source), filepath.Base(source))
+			case "copy":
+				logrus.Warnf("Removing copy %v", destination)
+				err = os.Remove(destination)
+			case "leave-symlink":
+				// the move recorded before it replaces the symlink
+				continue
+			case "hardlink", "symlink":
+				err = copyToDirectory(destination, filepath.Dir(source), filepath.Base(source))
+			case "remove", "trash":
+				logrus.Warnf("Can't undo %v of %v", action, source)
+				continue
+			default:
+				err = fmt.Errorf("unknown action %q in %v", action, args[0])
+			}
+			if err != nil {
+				logrus.Error(err)
+				failed++
+				continue
+			}
+			undone++
+		}
+
+		if !quiet {
+			fmt.Printf("Undid %v actions, %v failed\n", formatCount(undone), formatCount(failed))
+		}
+		if failed > 0 {
+			cmd.SilenceUsage = true
+			return ioError{fmt.Errorf("%v actions couldn't be undone", failed)}
+		}
+		return nil
+	},
+}
+
+// leftSymlink reports whether source is the symlink left behind by
+// --leave-symlink, which is replaced when undoing the move. links maps the
+// sources of the leave-symlink rows to where their symlinks pointed, a
+// symlink that isn't journaled or points elsewhere was made by someone else.
+func leftSymlink(source string, links map[string]string) bool {
+	target, has := links[source]
+	if !has {
+		return false
+	}
+	link, err := os.Readlink(source)
+	return err == nil && link == target
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+}
@@ -0,0 +1,209 @@
+package dedup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveExtensions are the extensions of the archives whose members are
+// scanned when ScanArchives is set.
+var ArchiveExtensions = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// ArchiveSeparator separates the path of an archive from the path of a member
+// in it, e.g. photos.zip!2020/beach.jpg.
+const ArchiveSeparator = "!"
+
+// isArchive reports whether path has one of the ArchiveExtensions.
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range ArchiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isArchiveMember reports whether info describes a member of an archive
+// rather than a file.
+func isArchiveMember(info os.FileInfo) bool {
+	switch info.Sys().(type) {
+	case *zip.FileHeader, *tar.Header:
+		return true
+	}
+	return false
+}
+
+// splitArchivePath splits path into the archive and the member in it, if it
+// is the path of an archive member.
+func splitArchivePath(path string) (string, string, bool) {
+	for i := strings.Index(path, ArchiveSeparator); i >= 0; {
+		archive := path[:i]
+		if isArchive(archive) {
+			if info, err := os.Stat(LongPath(archive)); err == nil && info.Mode().IsRegular() {
+				return archive, path[i+len(ArchiveSeparator):], true
+			}
+		}
+		next := strings.Index(path[i+1:], ArchiveSeparator)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return "", "", false
+}
+
+// openFile opens the file at path for reading, which may be an archive
+// member.
+func openFile(path string) (io.ReadCloser, error) {
+	if archive, member, ok := splitArchivePath(path); ok {
+		return openMember(archive, member)
+	}
+	return os.Open(LongPath(path))
+}
+
+// addArchive appends the members of the archive at path to found when
+// ScanArchives is set.
+func (d *Deduplicator) addArchive(result *Result, path string, found []fileJob) ([]fileJob, error) {
+	if !d.ScanArchives || !isArchive(path) {
+		return found, nil
+	}
+	members, err := d.archiveMembers(path, len(found))
+	if err != nil {
+		return found, d.fileError(result, path, err)
+	}
+	return append(found, members...), nil
+}
+
+// preferLoose wraps better so a file outside an archive is kept over one in
+// result.ArchiveMembers, which can't be the only copy left.
+func preferLoose(result *Result, better func(a, b PathTime) bool) func(a, b PathTime) bool {
+	return func(a, b PathTime) bool {
+		if inA, inB := result.ArchiveMembers[a], result.ArchiveMembers[b]; inA != inB {
+			return inB
+		}
+		return better(a, b)
+	}
+}
+
+// archiveMembers returns a job for each regular file in the archive at
+// archive that the Deduplicator would consider, numbered from index.
+func (d *Deduplicator) archiveMembers(archive string, index int) ([]fileJob, error) {
+	jobs := make([]fileJob, 0)
+	add := func(name string, info os.FileInfo) {
+		if !info.Mode().IsRegular() {
+			return
+		}
+		if job, ok := d.consider(archive+ArchiveSeparator+name, info, index+len(jobs)); ok {
+			jobs = append(jobs, job)
+		}
+	}
+
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		r, err := zip.OpenReader(LongPath(archive))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			add(f.Name, f.FileInfo())
+		}
+		return jobs, nil
+	}
+
+	f, tr, err := openTar(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return jobs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", archive, err)
+		}
+		add(path.Clean(header.Name), header.FileInfo())
+	}
+}
+
+// openTar opens the possibly gzipped tar archive at archive.
+func openTar(archive string) (*os.File, *tar.Reader, error) {
+	f, err := os.Open(LongPath(archive))
+	if err != nil {
+		return nil, nil, err
+	}
+	lower := strings.ToLower(archive)
+	if !strings.HasSuffix(lower, ".gz") && !strings.HasSuffix(lower, ".tgz") {
+		return f, tar.NewReader(f), nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%v: %w", archive, err)
+	}
+	return f, tar.NewReader(gz), nil
+}
+
+// member is an open archive member, closing it closes the archive.
+type member struct {
+	io.Reader
+	close func() error
+}
+
+func (m *member) Close() error {
+	return m.close()
+}
+
+// openMember opens the member called name of the archive at archive. Tar
+// archives can't be read out of order so they are read up to the member.
+func openMember(archive string, name string) (io.ReadCloser, error) {
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		r, err := zip.OpenReader(LongPath(archive))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range r.File {
+			if f.Name != name {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			return &member{rc, func() error {
+				rc.Close()
+				return r.Close()
+			}}, nil
+		}
+		r.Close()
+		return nil, fmt.Errorf("%v: no member %v", archive, name)
+	}
+
+	f, tr, err := openTar(archive)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			f.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%v: no member %v", archive, name)
+			}
+			return nil, fmt.Errorf("%v: %w", archive, err)
+		}
+		if path.Clean(header.Name) == name {
+			return &member{tr, f.Close}, nil
+		}
+	}
+}
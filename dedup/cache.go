@@ -0,0 +1,94 @@
+package dedup
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CacheEntry is the hash of a file along with what it took to compute it.
+// An entry is only reused if the file's size and modification time and the
+// hash algorithm are all unchanged.
+type CacheEntry struct {
+	Size int64     `json:"size"`
+	Time time.Time `json:"mtime"`
+	Hash string    `json:"hash"`
+	Sha  string    `json:"sha"`
+}
+
+// Cache maps the absolute path of a file to its cached hash so unchanged
+// files don't need to be rehashed between runs.
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]CacheEntry
+}
+
+// NewCache returns an empty cache.
+func NewCache() *Cache {
+	return &Cache{entries: map[string]CacheEntry{}}
+}
+
+// LoadCache reads a cache from filename. A missing file is treated as an
+// empty cache.
+func LoadCache(filename string) (*Cache, error) {
+	c := NewCache()
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Loading hash cache from %v", filename)
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the cache to filename.
+func (c *Cache) Save(filename string) error {
+	c.mu.RLock()
+	data, err := json.Marshal(c.entries)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Saving hash cache to %v", filename)
+	return os.WriteFile(filename, data, 0644)
+}
+
+// Get returns the cached hash of the file at path if it is still valid.
+func (c *Cache) Get(path string, info os.FileInfo, hashName string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	c.mu.RLock()
+	entry, has := c.entries[abs]
+	c.mu.RUnlock()
+	if !has || entry.Size != info.Size() || !entry.Time.Equal(info.ModTime()) || entry.Hash != hashName {
+		return "", false
+	}
+	return entry.Sha, true
+}
+
+// Put records the hash of the file at path.
+func (c *Cache) Put(path string, info os.FileInfo, hashName string, sha string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[abs] = CacheEntry{info.Size(), info.ModTime(), hashName, sha}
+	c.mu.Unlock()
+}
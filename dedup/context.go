@@ -0,0 +1,47 @@
+package dedup
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// contextReader is an io.Reader that fails with ctx's error once ctx is done,
+// so hashing a large file can be stopped part way through. When limiter is
+// not nil reads wait for it, a byte at a time.
+type contextReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// reader returns r wrapped in a contextReader using the ReadLimiter.
+func (d *Deduplicator) reader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx, r, d.ReadLimiter}
+}
+
+// RateLimitReader returns a reader of r that waits for limiter before
+// handing out bytes and fails once ctx is done.
+func RateLimitReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) io.Reader {
+	return &contextReader{ctx, r, limiter}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.limiter == nil {
+		return c.r.Read(p)
+	}
+
+	// WaitN fails when asked for more than the burst
+	if burst := c.limiter.Burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := c.r.Read(p)
+	if werr := c.limiter.WaitN(c.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
@@ -0,0 +1,1309 @@
+// Package dedup finds duplicate files by comparing their content hashes.
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+type PathTime struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// Stats counts the work done by a scan.
+type Stats struct {
+	// Files is the number of files found.
+	Files int
+	// Hashed is the number of files fully hashed, not counting cache hits.
+	Hashed int
+	// BytesRead is the number of bytes read to hash files, including the
+	// quick hashes.
+	BytesRead int64
+	// CacheHits is the number of files whose hash was found in the Cache.
+	CacheHits int
+	// HashTime is how long was spent hashing files.
+	HashTime time.Duration
+	// Duration is how long the whole scan took.
+	Duration time.Duration
+}
+
+// counters are the Stats being collected by a scan, the atomic ones are
+// updated by the workers.
+type counters struct {
+	files     int
+	hashed    atomic.Int64
+	bytesRead atomic.Int64
+	cacheHits atomic.Int64
+	hashTime  atomic.Int64
+}
+
+// DefaultBufferSize is the size of the buffer files are read into when
+// Deduplicator.BufferSize isn't set, the same as io.Copy uses.
+const DefaultBufferSize = 32 * 1024
+
+// MaxBufferSize caps Deduplicator.BufferSize, every worker has a buffer of
+// its own so larger buffers use a lot of memory for little gain.
+const MaxBufferSize = 64 * 1024 * 1024
+
+// Progress describes how many of the files to be hashed have been hashed.
+type Progress struct {
+	Files      int
+	TotalFiles int
+	Bytes      int64
+	TotalBytes int64
+}
+
+// Deduplicator holds the configuration used to scan for duplicate files.
+// The zero value hashes with sha256 using one worker per CPU.
+type Deduplicator struct {
+	// Hash is the name of the hash algorithm, see NewHasher.
+	Hash string
+	// Workers is the number of files hashed in parallel.
+	Workers int
+	// BufferSize is the size in bytes of the buffer each worker reads files
+	// into, at most MaxBufferSize. Defaults to DefaultBufferSize, larger
+	// buffers such as 1MB are faster on spinning disks.
+	BufferSize int
+	// MmapThreshold when positive memory maps files of at least this many
+	// bytes and hashes them straight from memory instead of copying them
+	// through a buffer. Files are still read normally where mmap isn't
+	// supported or fails. A mapped file that's truncated while it is hashed
+	// crashes the process, so only use it on files that aren't being changed.
+	MmapThreshold int64
+	// HashOffset and HashLength when not zero only hash the HashLength bytes
+	// of each file from HashOffset on, or all of them from HashOffset on when
+	// HashLength is 0. Files that end at or before HashOffset are skipped.
+	// Verify compares the same bytes, QuickHash has no effect and images
+	// hashed by their pixels are hashed whole.
+	HashOffset int64
+	HashLength int64
+	// Verify compares the content of files with matching hashes byte by byte
+	// before treating them as duplicates.
+	Verify bool
+	// Includes when not empty limits the scan to files whose name matches
+	// one of the glob patterns.
+	Includes []string
+	// Excludes skips files whose name matches one of the glob patterns.
+	Excludes []string
+	// ExcludeDirs skips directories matching one of the glob patterns
+	// without descending into them. A pattern without a separator matches
+	// the directory's name, otherwise its path below the root.
+	ExcludeDirs []string
+	// ExcludePaths skips the directories at these paths, such as the trash,
+	// without descending into them. A root itself is still walked.
+	ExcludePaths []string
+	// MatchRegex when not empty limits the scan to files whose path, with
+	// forward slashes, matches one of the expressions.
+	MatchRegex []*regexp.Regexp
+	// IgnoreRegex skips files whose path, with forward slashes, matches one
+	// of the expressions, and directories whose path followed by a slash
+	// does, e.g. (?i)/thumbnails?/.
+	IgnoreRegex []*regexp.Regexp
+	// ModifiedAfter when not zero skips files last modified at or before it.
+	ModifiedAfter time.Time
+	// ModifiedBefore when not zero skips files last modified at or after it.
+	ModifiedBefore time.Time
+	// SkipHidden skips hidden files and doesn't descend into hidden
+	// directories.
+	SkipHidden bool
+	// SkipAppleDouble skips the ._ files macOS keeps resource forks and
+	// extended attributes in on file systems without them, so they are
+	// neither deduped nor flattened.
+	SkipAppleDouble bool
+	// IncludeEmpty dedups empty files instead of skipping them. All empty
+	// files have the same hash so only one of them is kept.
+	IncludeEmpty bool
+	// LimitDepth only walks MaxDepth directories below each root, with a
+	// MaxDepth of 0 only the files directly in a root are considered.
+	LimitDepth bool
+	MaxDepth   int
+	// FollowSymlinks descends into symlinked directories, each directory is
+	// only walked once.
+	FollowSymlinks bool
+	// SeparateHardlinks treats every hardlink as a file of its own, so links
+	// to the same data are duplicates of each other. By default only the
+	// first link found is considered and the rest are recorded in
+	// Result.Hardlinks.
+	SeparateHardlinks bool
+	// SkipErrors logs and records files that can't be read in Result.Errors
+	// and carries on, instead of stopping the scan.
+	SkipErrors bool
+	// QuickHash first fingerprints files by their size and their first and
+	// last QuickHashSize bytes, and only fully hashes files whose fingerprint
+	// matches another file's. Files with different fingerprints can't have
+	// the same content, so this doesn't make false duplicates more likely.
+	QuickHash bool
+	// ScopeDepth when positive only treats files as duplicates of files in
+	// the same directory ScopeDepth levels below the root they were found in,
+	// so with 1 each top level directory is deduped on its own. The Result is
+	// keyed by the hash, a colon and that directory. Files given to ScanFiles
+	// aren't scoped.
+	ScopeDepth int
+	// ByName treats files with the same name as duplicates without reading
+	// them, the Result is keyed by name instead of hash. Files with the same
+	// name can have different content, so this is only safe for reporting.
+	ByName bool
+	// ByNameSize is like ByName but files must also have the same size, the
+	// Result is keyed by the size and name joined by a colon. It is a quick
+	// way to find likely duplicates without reading anything.
+	ByNameSize bool
+	// ImagePixels hashes the decoded pixels of images with one of the
+	// ImageExtensions instead of their bytes, so copies that only differ in
+	// their metadata, such as EXIF, or encoding are duplicates. Images of any
+	// size are compared with each other.
+	ImagePixels bool
+	// NormalizeText hashes the text of files with one of the TextExtensions
+	// with LF line endings and without trailing whitespace or blank lines at
+	// the end, so copies that only differ in those are duplicates. Text files
+	// are only duplicates of other text files, of any size. Files with a NUL
+	// byte near their start are binary and compared as they are.
+	NormalizeText bool
+	// FindSimilar groups the images left after removing exact duplicates
+	// whose perceptual hashes differ in at most SimilarityThreshold of their
+	// 64 bits from the kept image into Result.Similar.
+	FindSimilar bool
+	// SimilarityThreshold is the largest number of bits the perceptual hashes
+	// of two similar images may differ in.
+	SimilarityThreshold int
+	// Keep is the name of the policy deciding which of two duplicates is kept,
+	// see KeepPolicy. Defaults to oldest.
+	Keep string
+	// MtimeTolerance treats modification times less than this apart as equal
+	// when deciding which duplicate is kept, see KeepPolicyTolerance.
+	MtimeTolerance time.Duration
+	// PreferDir when not empty keeps a file under this directory over one
+	// that isn't, regardless of the Keep policy.
+	PreferDir string
+	// References are directories of reference files that are read but never
+	// changed. They are walked before the roots, a reference file is kept
+	// over any other duplicate and is never a duplicate itself.
+	References []string
+	// ScanArchives also reads the members of files with one of the
+	// ArchiveExtensions and dedups them as files with paths of the archive
+	// and the member joined by ArchiveSeparator. Archives are never changed,
+	// a file outside an archive is kept over a duplicate member.
+	ScanArchives bool
+	// ShouldProcess when not nil is called for every file that passes the
+	// other filters, files it returns false for are skipped.
+	ShouldProcess func(path string, info os.FileInfo) bool
+	// Fingerprint when not nil replaces Hash, files with the same
+	// fingerprint are duplicates. As files can have the same fingerprint
+	// whatever their size or bytes every file is fingerprinted, QuickHash,
+	// Verify and ImagePixels have no effect and the Cache isn't used.
+	Fingerprint func(r io.Reader) (string, error)
+	// ReadLimiter when not nil limits the rate files are read at in bytes
+	// per second, shared by all the workers.
+	ReadLimiter *rate.Limiter
+	// Cache when not nil is used to look up and store hashes.
+	Cache *Cache
+	// OnProgress when not nil is called after each file is hashed.
+	OnProgress func(Progress)
+	// OnEvent when not nil is called with each Event as the scan proceeds,
+	// always from the goroutine the scan was started on, see ScanStream.
+	OnEvent func(Event)
+}
+
+// Result is the outcome of a scan.
+type Result struct {
+	// Files maps each hash to the file that is kept.
+	Files map[string]PathTime
+	// Unique holds files known to be unique that are not tracked in Files.
+	Unique []PathTime
+	// Duplicates maps each duplicate file to the hash of the file it duplicates.
+	Duplicates map[PathTime]string
+	// Members maps each hash to every file with that content in the order
+	// they were found, including the kept file Files[hash].
+	Members map[string][]PathTime
+	// Hardlinks maps each file that is a hardlink to a file found earlier to
+	// the path of that file. They are neither unique nor duplicates.
+	Hardlinks map[PathTime]string
+	// References holds every file found under Deduplicator.References.
+	References map[PathTime]bool
+	// ArchiveMembers holds every file found inside an archive when
+	// Deduplicator.ScanArchives is set.
+	ArchiveMembers map[PathTime]bool
+	// Changed holds the files whose size or modification time changed
+	// between being found and being hashed. They are treated as unique and
+	// should be left alone.
+	Changed map[PathTime]bool
+	// Similar holds the groups of images that look alike but aren't
+	// duplicates when FindSimilar is set. Their hashes are perceptual hashes.
+	Similar []Group
+	// Errors holds the files skipped because of an error when SkipErrors is
+	// set.
+	Errors []FileError
+	// Stats counts the work done to get the Result.
+	Stats Stats
+}
+
+// FileError is an error for a single file that was skipped.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+// ReadError is returned by a scan stopped by a file that couldn't be read
+// or hashed, when SkipErrors isn't set. Its message is that of Err, which
+// names the file.
+type ReadError struct {
+	Path string
+	Err  error
+}
+
+func (e ReadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Group is a kept file and the files that duplicate it.
+type Group struct {
+	Hash       string
+	Kept       PathTime
+	Duplicates []PathTime
+}
+
+// Groups returns every group of duplicates sorted by hash, the duplicates
+// within a group are sorted by path.
+func (r *Result) Groups() []Group {
+	sorted := make([]Group, 0)
+	for sha, members := range r.Members {
+		if len(members) < 2 {
+			continue
+		}
+		sorted = append(sorted, r.group(sha))
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Hash < sorted[j].Hash
+	})
+	return sorted
+}
+
+// group returns the group of the files with the hash sha, the duplicates
+// sorted by path.
+func (r *Result) group(sha string) Group {
+	group := Group{Hash: sha, Kept: r.Files[sha]}
+	for _, file := range r.Members[sha] {
+		if file != group.Kept {
+			group.Duplicates = append(group.Duplicates, file)
+		}
+	}
+	sort.Slice(group.Duplicates, func(i, j int) bool {
+		return group.Duplicates[i].Path < group.Duplicates[j].Path
+	})
+	return group
+}
+
+// DuplicateSize returns the total size of the duplicate files, which is the
+// space that would be reclaimed by removing them.
+func (r *Result) DuplicateSize() int64 {
+	var size int64
+	for file := range r.Duplicates {
+		size += file.Size
+	}
+	return size
+}
+
+// UniqueFiles returns every file that is not a duplicate sorted by path.
+func (r *Result) UniqueFiles() []PathTime {
+	unique := make([]PathTime, 0, len(r.Unique)+len(r.Files))
+	unique = append(unique, r.Unique...)
+	for _, file := range r.Files {
+		unique = append(unique, file)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].Path < unique[j].Path
+	})
+	return unique
+}
+
+// fileJob is a file found during the walk that may need to be hashed.
+// The index records the walk order so results can be replayed deterministically.
+type fileJob struct {
+	index int
+	path  string
+	info  os.FileInfo
+	// scope is the directory the file is deduped within, see ScopeDepth.
+	scope string
+}
+
+// inode identifies a file's data on a device.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+type hashResult struct {
+	fileJob
+	sha string
+	err error
+}
+
+func (d *Deduplicator) hashName() string {
+	if d.Hash == "" {
+		return "sha256"
+	}
+	return d.Hash
+}
+
+func (d *Deduplicator) keepName() string {
+	if d.Keep == "" {
+		return "oldest"
+	}
+	return d.Keep
+}
+
+func (d *Deduplicator) bufferSize() int {
+	if d.BufferSize < 1 {
+		return DefaultBufferSize
+	}
+	return d.BufferSize
+}
+
+func (d *Deduplicator) workers() int {
+	if d.Workers < 1 {
+		return runtime.NumCPU()
+	}
+	return d.Workers
+}
+
+// Scan walks every root and hashes every file that shares its size with at
+// least one other file, using a pool of workers. Files with a unique size
+// can't have a duplicate so they are recorded in Result.Unique without being
+// read. Once all files are hashed the results are applied in walk order so the
+// outcome does not depend on the number of workers.
+func (d *Deduplicator) Scan(roots []string) (*Result, error) {
+	return d.ScanContext(context.Background(), roots)
+}
+
+// ScanContext is like Scan but stops once ctx is done. The files hashed
+// before that are returned along with ctx's error, if the walk itself was
+// stopped the result is empty.
+func (d *Deduplicator) ScanContext(ctx context.Context, roots []string) (*Result, error) {
+	return d.scan(ctx, func(result *Result) ([]fileJob, error) {
+		found := make([]fileJob, 0)
+		for _, root := range roots {
+			var err error
+			found, err = d.walkDirectory(ctx, result, root, found)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return found, nil
+	})
+}
+
+// ScanStream is like ScanContext but calls onEvent with each Event as the
+// scan proceeds, so results can be shown before it is done.
+func (d *Deduplicator) ScanStream(ctx context.Context, roots []string, onEvent func(Event)) (*Result, error) {
+	stream := *d
+	stream.OnEvent = onEvent
+	return stream.ScanContext(ctx, roots)
+}
+
+// ScanFiles is like Scan except instead of walking directories exactly the
+// given files are considered, in order.
+func (d *Deduplicator) ScanFiles(paths []string) (*Result, error) {
+	return d.ScanFilesContext(context.Background(), paths)
+}
+
+// ScanFilesContext is like ScanFiles but stops once ctx is done, see
+// ScanContext.
+func (d *Deduplicator) ScanFilesContext(ctx context.Context, paths []string) (*Result, error) {
+	return d.scan(ctx, func(result *Result) ([]fileJob, error) {
+		found := make([]fileJob, 0, len(paths))
+		for _, path := range paths {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			info, err := os.Lstat(LongPath(path))
+			if err != nil {
+				if err := d.fileError(result, path, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if job, ok := d.consider(path, info, len(found)); ok {
+				found = append(found, job)
+				if found, err = d.addArchive(result, path, found); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return found, nil
+	})
+}
+
+// newResult returns an empty Result.
+func newResult() *Result {
+	return &Result{
+		Files:          map[string]PathTime{},
+		Unique:         []PathTime{},
+		Duplicates:     map[PathTime]string{},
+		Members:        map[string][]PathTime{},
+		References:     map[PathTime]bool{},
+		ArchiveMembers: map[PathTime]bool{},
+		Changed:        map[PathTime]bool{},
+		Similar:        []Group{},
+		Errors:         []FileError{},
+		Hardlinks:      map[PathTime]string{},
+	}
+}
+
+// scan hashes the files returned by find and sorts them into a Result.
+func (d *Deduplicator) scan(ctx context.Context, find func(*Result) ([]fileJob, error)) (*Result, error) {
+	start := time.Now()
+	counts := &counters{}
+	result, err := d.dedup(ctx, find, counts)
+	if result != nil {
+		result.Stats = Stats{
+			Files:     counts.files,
+			Hashed:    int(counts.hashed.Load()),
+			BytesRead: counts.bytesRead.Load(),
+			CacheHits: int(counts.cacheHits.Load()),
+			HashTime:  time.Duration(counts.hashTime.Load()),
+			Duration:  time.Since(start),
+		}
+	}
+	return result, err
+}
+
+// dedup does the work of scan, counting what it does in counts.
+func (d *Deduplicator) dedup(ctx context.Context, find func(*Result) ([]fileJob, error), counts *counters) (*Result, error) {
+	if _, err := NewHasher(d.hashName()); err != nil {
+		return nil, err
+	}
+	if d.BufferSize > MaxBufferSize {
+		return nil, fmt.Errorf("buffer size must be at most %v bytes, got %v", MaxBufferSize, d.BufferSize)
+	}
+	if d.HashOffset < 0 || d.HashLength < 0 {
+		return nil, fmt.Errorf("hash offset and length must not be negative, got %v and %v", d.HashOffset, d.HashLength)
+	}
+	if d.FindSimilar && (d.SimilarityThreshold < 0 || d.SimilarityThreshold > 64) {
+		return nil, fmt.Errorf("similarity threshold must be between 0 and 64, got %v", d.SimilarityThreshold)
+	}
+	if d.MtimeTolerance < 0 {
+		return nil, fmt.Errorf("mtime tolerance must not be negative, got %v", d.MtimeTolerance)
+	}
+	better, err := KeepPolicyTolerance(d.keepName(), d.MtimeTolerance)
+	if err != nil {
+		return nil, err
+	}
+	if d.PreferDir != "" {
+		better, err = preferDir(d.PreferDir, better)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, ref := range d.References {
+		better, err = preferDir(ref, better)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range append(append(append([]string{}, d.Includes...), d.Excludes...), d.ExcludeDirs...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	result := newResult()
+	found := make([]fileJob, 0)
+	for _, ref := range d.References {
+		found, err = d.walkDirectory(ctx, result, ref, found)
+		if err != nil {
+			break
+		}
+	}
+	for _, job := range found {
+		result.References[PathTime{job.path, job.info.ModTime(), job.info.Size()}] = true
+	}
+	if err == nil {
+		var roots []fileJob
+		roots, err = find(result)
+		for _, job := range roots {
+			if !d.isReference(job.path) {
+				job.index = len(found)
+				found = append(found, job)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		// the walk is incomplete so nothing is known to be unique yet
+		partial := newResult()
+		partial.Errors = result.Errors
+		return partial, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	counts.files = len(found)
+	for _, job := range found {
+		if isArchiveMember(job.info) {
+			result.ArchiveMembers[PathTime{job.path, job.info.ModTime(), job.info.Size()}] = true
+		}
+	}
+	better = preferLoose(result, better)
+
+	// hardlinks to the same data aren't duplicates of each other so only the
+	// first link found is considered
+	links := make(map[inode]string)
+	linked := found[:0]
+	for _, job := range found {
+		if id, ok := fileID(job.info); ok && !d.SeparateHardlinks {
+			if first, has := links[id]; has {
+				logrus.Debugf("Found: %v : hardlink of %v", job.path, first)
+				result.Hardlinks[PathTime{job.path, job.info.ModTime(), job.info.Size()}] = first
+				continue
+			}
+			links[id] = job.path
+		}
+		linked = append(linked, job)
+	}
+	found = linked
+
+	if d.ByName || d.ByNameSize {
+		for _, job := range found {
+			key := filepath.Base(job.path)
+			if d.ByNameSize {
+				key = fmt.Sprintf("%v:%v", job.info.Size(), key)
+			}
+			if err := d.addFile(ctx, result, better, scopedKey(job.scope, key), job.path, job.info); err != nil {
+				return nil, err
+			}
+		}
+		// nothing is left to hash
+		found = nil
+	}
+
+	sizes := make(map[int64][]fileJob)
+	for _, job := range found {
+		size := d.hashedSize(job.info.Size())
+		sizes[size] = append(sizes[size], job)
+	}
+
+	candidates := make([]fileJob, 0, len(found))
+	for _, job := range found {
+		if d.normalized(job.path) || d.Fingerprint != nil {
+			candidates = append(candidates, job)
+			continue
+		}
+		if len(sizes[d.hashedSize(job.info.Size())]) == 1 {
+			logrus.Debugf("Found: %v : unique filesize:%v", job.path, job.info.Size())
+			result.Unique = append(result.Unique, PathTime{job.path, job.info.ModTime(), job.info.Size()})
+			continue
+		}
+		candidates = append(candidates, job)
+	}
+
+	if d.QuickHash && d.Fingerprint == nil && !d.hashesSection() {
+		var err error
+		candidates, err = d.quickFilter(ctx, result, candidates, counts)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+	}
+
+	applied, finish := d.groupCompletion(result, candidates)
+	apply := func(h hashResult) error {
+		defer applied(h)
+		if h.err != nil && ctx.Err() != nil {
+			return nil
+		}
+		if h.err != nil {
+			return d.fileError(result, h.path, h.err)
+		}
+		if changed(h.fileJob) {
+			// the hash may not match what's in the file now
+			logrus.Warnf("%v changed while it was hashed, leaving it alone", h.path)
+			file := PathTime{h.path, h.info.ModTime(), h.info.Size()}
+			result.Unique = append(result.Unique, file)
+			result.Changed[file] = true
+			return nil
+		}
+		if d.Cache != nil && d.Fingerprint == nil {
+			d.Cache.Put(h.path, h.info, d.cacheName(h.path), h.sha)
+		}
+		if err := d.addFile(ctx, result, better, scopedKey(h.scope, h.sha), h.path, h.info); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			return d.fileError(result, h.path, err)
+		}
+		return nil
+	}
+
+	// the results are applied in walk order as soon as every file before
+	// them is hashed, so events are sent while the rest are hashed
+	position := make(map[int]int, len(candidates))
+	for i, job := range candidates {
+		position[job.index] = i
+	}
+	pending := make(map[int]hashResult)
+	next := 0
+	var applyErr error
+	hashed := d.hashFiles(ctx, counts, candidates, func(ctx context.Context, job fileJob) (string, error) {
+		return d.cachedHashFile(ctx, job, counts)
+	}, func(h hashResult) {
+		if h.err == nil {
+			d.event(Event{Kind: FileHashed, Hash: h.sha, File: PathTime{h.path, h.info.ModTime(), h.info.Size()}})
+		}
+		pending[position[h.index]] = h
+		for ; ; next++ {
+			h, has := pending[next]
+			if !has {
+				break
+			}
+			delete(pending, next)
+			if applyErr == nil {
+				applyErr = apply(h)
+			}
+		}
+	})
+	// files after one that wasn't hashed before ctx was done
+	for _, h := range hashed {
+		if _, has := pending[position[h.index]]; has && applyErr == nil {
+			applyErr = apply(h)
+		}
+	}
+	if applyErr != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		return nil, applyErr
+	}
+	if ctx.Err() == nil {
+		finish()
+	}
+
+	if d.FindSimilar && ctx.Err() == nil {
+		result.Similar, err = d.similarGroups(ctx, result, better, counts)
+		if err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+	}
+	return result, ctx.Err()
+}
+
+// changed reports whether the file of job was changed or removed since it
+// was found.
+func changed(job fileJob) bool {
+	if isArchiveMember(job.info) {
+		return false
+	}
+	info, err := os.Lstat(LongPath(job.path))
+	return err != nil || info.Size() != job.info.Size() || !info.ModTime().Equal(job.info.ModTime())
+}
+
+// isReference reports whether the file at path is under one of the
+// References.
+func (d *Deduplicator) isReference(path string) bool {
+	for _, ref := range d.References {
+		if dir, err := filepath.Abs(ref); err == nil && isUnder(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileError logs err for the file at path. With SkipErrors it is recorded in
+// result and nil is returned so the scan can continue, otherwise err is
+// returned as a ReadError.
+func (d *Deduplicator) fileError(result *Result, path string, err error) error {
+	logrus.Error(err)
+	if !d.SkipErrors {
+		return ReadError{path, err}
+	}
+	result.Errors = append(result.Errors, FileError{path, err})
+	return nil
+}
+
+// walkDirectory appends every non-empty file under root to found in walk
+// order, skipping anything matched by the root's IgnoreFile.
+func (d *Deduplicator) walkDirectory(ctx context.Context, result *Result, root string, found []fileJob) ([]fileJob, error) {
+	patterns, err := readIgnoreFile(root)
+	if err != nil {
+		return found, err
+	}
+
+	excludedPaths := make(map[string]bool, len(d.ExcludePaths))
+	for _, dir := range d.ExcludePaths {
+		if abs, err := filepath.Abs(dir); err == nil {
+			excludedPaths[abs] = true
+		}
+	}
+
+	walk := filepath.Walk
+	if d.FollowSymlinks {
+		walk = walkFollowingSymlinks
+	}
+
+	// walk the extended-length form of root so deep paths can be opened on
+	// Windows, reporting them under root as given
+	longRoot := LongPath(root)
+	err = walk(longRoot, func(path string, info os.FileInfo, e error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == longRoot {
+			path = root
+		} else if rel, err := filepath.Rel(longRoot, path); err == nil {
+			path = filepath.Join(root, rel)
+		}
+
+		if e != nil {
+			return d.fileError(result, path, e)
+		}
+
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+			if rel == IgnoreFile || ignored(patterns, rel) {
+				logrus.Debugf("Found: %v : SKIPPING ignored", path)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.SkipHidden && path != root && isHidden(path, info) {
+			logrus.Debugf("Found: %v : SKIPPING hidden", path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode().IsDir() {
+			if rel, err := filepath.Rel(root, path); err == nil && rel != "." && ignored(d.ExcludeDirs, rel) {
+				logrus.Debugf("Found: %v : SKIPPING excluded directory", path)
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(path); err == nil && path != root && excludedPaths[abs] {
+				logrus.Debugf("Found: %v : SKIPPING excluded path", path)
+				return filepath.SkipDir
+			}
+			if path != root && matchesAny(d.IgnoreRegex, filepath.ToSlash(path)+"/") {
+				logrus.Debugf("Found: %v : SKIPPING ignored directory", path)
+				return filepath.SkipDir
+			}
+			if d.LimitDepth && path != root && depth(root, path) > d.MaxDepth {
+				logrus.Debugf("Found: %v : SKIPPING deeper than %v", path, d.MaxDepth)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if job, ok := d.consider(path, info, len(found)); ok {
+			start := len(found)
+			found = append(found, job)
+			found, err = d.addArchive(result, path, found)
+			for i := start; i < len(found); i++ {
+				found[i].scope = d.scope(root, path)
+			}
+			return err
+		}
+		return nil
+	})
+	return found, err
+}
+
+// scope returns the directory ScopeDepth levels below root that the file at
+// path is in, or its own directory if it isn't that deep.
+func (d *Deduplicator) scope(root string, path string) string {
+	if d.ScopeDepth <= 0 {
+		return ""
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return filepath.Clean(root)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	return filepath.Join(root, filepath.Join(parts[:min(len(parts), d.ScopeDepth)]...))
+}
+
+// scopedKey returns the key of the files with the hash sha in scope.
+func scopedKey(scope string, sha string) string {
+	if scope == "" {
+		return sha
+	}
+	return sha + ":" + filepath.ToSlash(scope)
+}
+
+// depth returns how many directories below root the files in the directory
+// dir are.
+func depth(root string, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// consider returns the job to hash the file at path unless it should be
+// skipped because it is a directory, empty or filtered out.
+func (d *Deduplicator) consider(path string, info os.FileInfo, index int) (fileJob, bool) {
+	if info.Mode().IsDir() {
+		logrus.Debugf("Found: %v : SKIPPING directory", path)
+		return fileJob{}, false
+	}
+
+	// a symlink would be hashed through its target, so it could be kept
+	// while the target is removed as its duplicate
+	if info.Mode()&os.ModeSymlink != 0 {
+		logrus.Debugf("Found: %v : SKIPPING symlink", path)
+		return fileJob{}, false
+	}
+
+	// opening a FIFO or a device can block forever, they are empty so only
+	// get this far with IncludeEmpty
+	if !info.Mode().IsRegular() {
+		logrus.Debugf("Found: %v : SKIPPING not a regular file", path)
+		return fileJob{}, false
+	}
+
+	if info.Size() == 0 && !d.IncludeEmpty {
+		logrus.Debugf("Found: %v : SKIPPING filesize:0", path)
+		return fileJob{}, false
+	}
+
+	if d.SkipAppleDouble && strings.HasPrefix(filepath.Base(path), "._") {
+		logrus.Debugf("Found: %v : SKIPPING AppleDouble", path)
+		return fileJob{}, false
+	}
+
+	if d.hashesSection() && info.Size() <= d.HashOffset {
+		logrus.Debugf("Found: %v : SKIPPING shorter than hash offset %v", path, d.HashOffset)
+		return fileJob{}, false
+	}
+
+	if !d.ModifiedAfter.IsZero() && !info.ModTime().After(d.ModifiedAfter) {
+		logrus.Debugf("Found: %v : SKIPPING modified before %v", path, d.ModifiedAfter)
+		return fileJob{}, false
+	}
+
+	if !d.ModifiedBefore.IsZero() && !info.ModTime().Before(d.ModifiedBefore) {
+		logrus.Debugf("Found: %v : SKIPPING modified after %v", path, d.ModifiedBefore)
+		return fileJob{}, false
+	}
+
+	if !d.matchesFilters(filepath.Base(path)) || !d.matchesRegex(filepath.ToSlash(path)) {
+		logrus.Debugf("Found: %v : SKIPPING filtered", path)
+		return fileJob{}, false
+	}
+
+	if d.ShouldProcess != nil && !d.ShouldProcess(path, info) {
+		logrus.Debugf("Found: %v : SKIPPING by ShouldProcess", path)
+		return fileJob{}, false
+	}
+
+	return fileJob{index, path, info, ""}, true
+}
+
+// matchesRegex reports whether path matches any of the MatchRegex
+// expressions (when given) and none of the IgnoreRegex expressions.
+func (d *Deduplicator) matchesRegex(path string) bool {
+	if matchesAny(d.IgnoreRegex, path) {
+		return false
+	}
+	return len(d.MatchRegex) == 0 || matchesAny(d.MatchRegex, path)
+}
+
+// matchesAny reports whether s matches any of the expressions.
+func matchesAny(expressions []*regexp.Regexp, s string) bool {
+	for _, re := range expressions {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFilters reports whether name matches any of the Includes patterns
+// (when given) and none of the Excludes patterns.
+func (d *Deduplicator) matchesFilters(name string) bool {
+	for _, pattern := range d.Excludes {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return false
+		}
+	}
+
+	if len(d.Includes) == 0 {
+		return true
+	}
+	for _, pattern := range d.Includes {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFiles hashes the given files with hash using a pool of workers. The
+// results are returned in walk order, onResult when not nil is called with
+// each as it comes in. Once ctx is done hashFiles returns
+// right away with only the files already hashed.
+func (d *Deduplicator) hashFiles(ctx context.Context, counts *counters, toHash []fileJob, hash func(context.Context, fileJob) (string, error), onResult func(hashResult)) []hashResult {
+	start := time.Now()
+	defer func() {
+		counts.hashTime.Add(int64(time.Since(start)))
+	}()
+
+	jobs := make(chan fileJob)
+	// room for every worker's last result so none are left blocked once
+	// ctx is done and the results are no longer read
+	results := make(chan hashResult, d.workers())
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				sha, err := hash(ctx, job)
+				results <- hashResult{job, sha, err}
+			}
+		}()
+	}
+
+	go func() {
+	feed:
+		for _, job := range toHash {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	progress := Progress{TotalFiles: len(toHash)}
+	for _, job := range toHash {
+		progress.TotalBytes += job.info.Size()
+	}
+
+	hashed := make([]hashResult, 0, len(toHash))
+collect:
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				break collect
+			}
+			hashed = append(hashed, result)
+			if d.OnProgress != nil {
+				progress.Files++
+				progress.Bytes += result.info.Size()
+				d.OnProgress(progress)
+			}
+			if onResult != nil {
+				onResult(result)
+			}
+		case <-ctx.Done():
+			// a read stuck on a hung network share may never return so
+			// don't wait for the workers
+			break collect
+		}
+	}
+
+	sort.Slice(hashed, func(i, j int) bool {
+		return hashed[i].index < hashed[j].index
+	})
+	return hashed
+}
+
+// cacheName is the name the hash of the file at path is cached under, images
+// hashed by their pixels and normalized text are kept apart from hashes of
+// their bytes.
+func (d *Deduplicator) cacheName(path string) string {
+	if d.isImage(path) {
+		return "pixels-" + d.hashName()
+	}
+	name := d.hashName()
+	if d.isText(path) {
+		name = "text-" + name
+	}
+	if d.hashesSection() {
+		return fmt.Sprintf("%v-%v+%v", name, d.HashOffset, d.HashLength)
+	}
+	return name
+}
+
+// hashesSection reports whether only part of each file is hashed, see
+// HashOffset.
+func (d *Deduplicator) hashesSection() bool {
+	return d.HashOffset > 0 || d.HashLength > 0
+}
+
+// hashedSize returns how many bytes of a file of size bytes are hashed.
+func (d *Deduplicator) hashedSize(size int64) int64 {
+	if !d.hashesSection() {
+		return size
+	}
+	size = max(0, size-d.HashOffset)
+	if d.HashLength > 0 {
+		size = min(size, d.HashLength)
+	}
+	return size
+}
+
+// section returns a reader of the bytes read by r that are hashed, see
+// HashOffset, stopping once ctx is done.
+func (d *Deduplicator) section(ctx context.Context, r io.Reader) (io.Reader, error) {
+	if !d.hashesSection() {
+		return d.reader(ctx, r), nil
+	}
+	length := int64(math.MaxInt64) - d.HashOffset
+	if d.HashLength > 0 {
+		length = d.HashLength
+	}
+	if at, ok := r.(io.ReaderAt); ok {
+		return d.reader(ctx, io.NewSectionReader(at, d.HashOffset, length)), nil
+	}
+	// archive members can only be read in order
+	r = d.reader(ctx, r)
+	if _, err := io.CopyN(io.Discard, r, d.HashOffset); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(r, length), nil
+}
+
+// cachedHashFile returns the hash of the file from the Cache if it has a
+// valid entry, otherwise the file is hashed.
+func (d *Deduplicator) cachedHashFile(ctx context.Context, job fileJob, counts *counters) (string, error) {
+	if d.Fingerprint != nil {
+		counts.hashed.Add(1)
+		counts.bytesRead.Add(job.info.Size())
+		return d.fingerprint(ctx, job)
+	}
+	if d.Cache != nil {
+		if sha, has := d.Cache.Get(job.path, job.info, d.cacheName(job.path)); has {
+			counts.cacheHits.Add(1)
+			return sha, nil
+		}
+	}
+	counts.hashed.Add(1)
+	counts.bytesRead.Add(d.hashedSize(job.info.Size()))
+	if d.isImage(job.path) {
+		return d.pixelHash(ctx, job)
+	}
+	if d.isText(job.path) {
+		return d.textHash(ctx, job)
+	}
+	return d.hashFile(ctx, job)
+}
+
+// fingerprint returns the Fingerprint of the file of job.
+func (d *Deduplicator) fingerprint(ctx context.Context, job fileJob) (string, error) {
+	f, err := openFile(job.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	r, err := d.section(ctx, f)
+	if err != nil {
+		return "", err
+	}
+	return d.Fingerprint(r)
+}
+
+// openHashed opens the files hashFile hashes, tests replace it to make reads
+// fail.
+var openHashed = openFile
+
+func (d *Deduplicator) hashFile(ctx context.Context, job fileJob) (string, error) {
+	// for each file we open and run the selected hash on it
+	f, err := openHashed(job.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h, err := NewHasher(d.hashName())
+	if err != nil {
+		return "", err
+	}
+	size := d.hashedSize(job.info.Size())
+	if file, ok := f.(*os.File); ok && d.MmapThreshold > 0 && job.info.Size() >= d.MmapThreshold {
+		data, unmap, err := mmapFile(file, job.info.Size())
+		if err == nil {
+			defer unmap()
+			offset := min(d.HashOffset, int64(len(data)))
+			return d.hashMapped(ctx, h, data[offset:offset+min(size, int64(len(data))-offset)])
+		}
+		logrus.Debugf("Found: %v : can't mmap, reading instead: %v", job.path, err)
+	}
+
+	r, err := d.section(ctx, f)
+	if err != nil {
+		return "", err
+	}
+	// no point in a buffer bigger than the file
+	buf := make([]byte, max(1, min(int64(d.bufferSize()), size)))
+	if _, err := io.CopyBuffer(h, r, buf); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hashMapped writes the memory mapped data to h a chunk of BufferSize at a
+// time, stopping if ctx is done.
+func (d *Deduplicator) hashMapped(ctx context.Context, h hash.Hash, data []byte) (string, error) {
+	for len(data) > 0 {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n := min(len(data), d.bufferSize())
+		if d.ReadLimiter != nil {
+			if burst := d.ReadLimiter.Burst(); burst > 0 {
+				n = min(n, burst)
+			}
+			if err := d.ReadLimiter.WaitN(ctx, n); err != nil {
+				return "", err
+			}
+		}
+		h.Write(data[:n])
+		data = data[n:]
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func (d *Deduplicator) addFile(ctx context.Context, result *Result, better func(a, b PathTime) bool, sha string, path string, info os.FileInfo) error {
+	logrus.Debugf("Found: %v : %v", path, sha)
+	// now we keep a history so we check if it's already in the history
+	// if not we add it
+	// and if it does exist we do some checks to decide which file will be the "duplicate"
+
+	old, has := result.Files[sha]
+
+	fileInfo := PathTime{path, info.ModTime(), info.Size()}
+	if !has {
+		result.Files[sha] = fileInfo
+		result.Members[sha] = []PathTime{fileInfo}
+		return nil
+	}
+
+	if d.isReference(old.Path) && d.isReference(path) {
+		logrus.Debugf("Found: %v : reference copy of %v", path, old.Path)
+		result.Unique = append(result.Unique, fileInfo)
+		return nil
+	}
+
+	if d.Verify && !d.ByName && !d.ByNameSize && d.Fingerprint == nil {
+		compare := d.sameContent
+		if d.isImage(old.Path) && d.isImage(path) {
+			compare = d.samePixels
+		}
+		same, err := compare(ctx, old.Path, path)
+		if err != nil {
+			return err
+		}
+		if !same {
+			logrus.Errorf("%v and %v have the same hash but different content, keeping both", old.Path, path)
+			result.Unique = append(result.Unique, fileInfo)
+			return nil
+		}
+	}
+
+	result.Members[sha] = append(result.Members[sha], fileInfo)
+	if better(fileInfo, old) {
+		result.Files[sha] = fileInfo
+		result.Duplicates[old] = sha
+		d.event(Event{Kind: DuplicateFound, Hash: sha, File: old, Kept: fileInfo})
+		return nil
+	}
+	result.Duplicates[fileInfo] = sha
+	d.event(Event{Kind: DuplicateFound, Hash: sha, File: fileInfo, Kept: old})
+	return nil
+}
+
+// sameContent reports whether the files a and b have identical content.
+func (d *Deduplicator) sameContent(ctx context.Context, a string, b string) (bool, error) {
+	fa, err := openFile(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+
+	fb, err := openFile(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	ra, err := d.section(ctx, fa)
+	if err != nil {
+		return false, err
+	}
+	rb, err := d.section(ctx, fb)
+	if err != nil {
+		return false, err
+	}
+	// compare what was hashed
+	if d.isText(a) {
+		ra = newTextReader(ra)
+	}
+	if d.isText(b) {
+		rb = newTextReader(rb)
+	}
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+
+		doneA := errors.Is(errA, io.EOF) || errors.Is(errA, io.ErrUnexpectedEOF)
+		doneB := errors.Is(errB, io.EOF) || errors.Is(errB, io.ErrUnexpectedEOF)
+		if doneA || doneB {
+			return doneA == doneB, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
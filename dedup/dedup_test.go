@@ -0,0 +1,182 @@
+package dedup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFiles creates the files named by the keys of files under dir with
+// their values as content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var errRead = errors.New("read failed")
+
+// failingReader fails with errRead after reading the start of content
+// beginning with "bad".
+type failingReader struct {
+	r       io.Reader
+	started bool
+	bad     bool
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.bad {
+		return 0, errRead
+	}
+	if f.started {
+		return f.r.Read(p)
+	}
+	f.started = true
+	n, err := f.r.Read(p[:min(len(p), 3)])
+	f.bad = bytes.Equal(p[:n], []byte("bad"))
+	return n, err
+}
+
+// failingFile is a file read through a failingReader.
+type failingFile struct {
+	failingReader
+	io.Closer
+}
+
+// openFailing opens the file at path to be read through a failingReader.
+func openFailing(path string) (io.ReadCloser, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &failingFile{failingReader{r: f}, f}, nil
+}
+
+func TestReadErrorSkipped(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a":        "good content",
+		"sub/b":    "good content",
+		"c":        "bad content!",
+		"sub/d":    "bad content!",
+		"sub/e/f":  "good content",
+		"unique-g": "no other file this size",
+	})
+
+	openHashed = openFailing
+	defer func() { openHashed = openFile }()
+
+	d := &Deduplicator{Workers: 2, SkipErrors: true}
+	result, err := d.Scan([]string{dir})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	failed := map[string]bool{}
+	for _, e := range result.Errors {
+		if !errors.Is(e.Err, errRead) {
+			t.Errorf("unexpected error for %v: %v", e.Path, e.Err)
+		}
+		failed[e.Path] = true
+	}
+	for _, name := range []string{"c", "sub/d"} {
+		if !failed[filepath.Join(dir, name)] {
+			t.Errorf("%v isn't in Result.Errors: %v", name, result.Errors)
+		}
+	}
+	if len(result.Errors) != 2 {
+		t.Errorf("got %v errors, want 2: %v", len(result.Errors), result.Errors)
+	}
+	// the files after the failed ones were still hashed
+	if groups := result.Groups(); len(groups) != 1 || len(groups[0].Duplicates) != 2 {
+		t.Errorf("got groups %v, want the 3 good files in one", groups)
+	}
+
+	d.SkipErrors = false
+	if _, err := d.Scan([]string{dir}); !errors.Is(err, errRead) {
+		t.Errorf("Scan without SkipErrors returned %v, want %v", err, errRead)
+	}
+}
+
+func TestScanStable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 60; i++ {
+		// groups of up to 4 copies mixed with files of the same size
+		files[fmt.Sprintf("d%v/f%02v", i%5, i)] = fmt.Sprintf("content %02v", i%17)
+	}
+	writeFiles(t, dir, files)
+
+	var first *Result
+	for run := 0; run < 5; run++ {
+		d := &Deduplicator{Workers: 8}
+		result, err := d.Scan([]string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			first = result
+			if len(result.Duplicates) == 0 {
+				t.Fatal("no duplicates found")
+			}
+			continue
+		}
+		if !reflect.DeepEqual(result.Files, first.Files) {
+			t.Errorf("run %v: Files differ", run)
+		}
+		if !reflect.DeepEqual(result.Duplicates, first.Duplicates) {
+			t.Errorf("run %v: Duplicates differ", run)
+		}
+		if !reflect.DeepEqual(result.Groups(), first.Groups()) {
+			t.Errorf("run %v: groups differ", run)
+		}
+	}
+}
+
+func TestSymlinkNotHashed(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a/x.txt": "same text\n", "c/y.txt": "other text\n"})
+	target := filepath.Join(dir, "a", "x.txt")
+	link := filepath.Join(dir, "b", "x.txt")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// what --symlink leaves in place of a duplicate
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(target, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		// the newest would be the link, text is compared whatever its size
+		d := &Deduplicator{Keep: "newest", NormalizeText: true, FollowSymlinks: follow}
+		result, err := d.Scan([]string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Duplicates) != 0 {
+			t.Errorf("follow %v: the target is a duplicate of its symlink: %v", follow, result.Duplicates)
+		}
+		for _, file := range result.UniqueFiles() {
+			if file.Path == link {
+				t.Errorf("follow %v: the symlink was scanned", follow)
+			}
+		}
+	}
+}
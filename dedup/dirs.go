@@ -0,0 +1,158 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dirNode is a directory found in a Result, see DirectoryGroups.
+type dirNode struct {
+	path     string
+	children []string
+	size     int64
+	// unique is set when a file below the directory has no duplicate,
+	// so neither does the directory.
+	unique bool
+}
+
+// DirectoryGroups returns every group of directories at or below one of
+// roots whose files have the same content and are laid out in the same
+// directories, sorted by hash. Only the topmost directories that match are
+// returned, not the directories inside them. A group's Kept is the directory
+// whose path sorts first and the Size of each directory is that of its
+// files. Files that weren't scanned, such as empty files or those left out
+// by the filters, aren't compared.
+func (r *Result) DirectoryGroups(roots []string) []Group {
+	absRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			absRoots = append(absRoots, abs)
+		}
+	}
+	underRoot := func(dir string) bool {
+		for _, root := range absRoots {
+			if isUnder(dir, root) {
+				return true
+			}
+		}
+		return false
+	}
+
+	nodes := make(map[string]*dirNode)
+	node := func(dir string) *dirNode {
+		n, has := nodes[dir]
+		if !has {
+			n = &dirNode{path: dir}
+			nodes[dir] = n
+		}
+		return n
+	}
+	add := func(file PathTime, key string) {
+		if r.ArchiveMembers[file] {
+			return
+		}
+		dir := filepath.Dir(file.Path)
+		if !underRoot(dir) {
+			return
+		}
+		n := node(dir)
+		n.children = append(n.children, "file:"+key)
+		n.size += file.Size
+		n.unique = n.unique || key == ""
+	}
+
+	keys := make(map[string]string)
+	for key, file := range r.Files {
+		keys[file.Path] = key
+		add(file, key)
+	}
+	for file, key := range r.Duplicates {
+		keys[file.Path] = key
+		add(file, key)
+	}
+	for file, first := range r.Hardlinks {
+		add(file, keys[first])
+	}
+	for _, file := range r.Unique {
+		add(file, "")
+	}
+
+	// the deepest directories are hashed first so their parents can include
+	// their hashes
+	dirs := make([]string, 0, len(nodes))
+	for dir := range nodes {
+		dirs = append(dirs, dir)
+	}
+	for i := 0; i < len(dirs); i++ {
+		parent := filepath.Dir(dirs[i])
+		if _, has := nodes[parent]; !has && parent != dirs[i] && underRoot(parent) {
+			node(parent)
+			dirs = append(dirs, parent)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := strings.Count(dirs[i], string(filepath.Separator)), strings.Count(dirs[j], string(filepath.Separator))
+		if di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	hashes := make(map[string]string, len(dirs))
+	byHash := make(map[string][]*dirNode)
+	for _, dir := range dirs {
+		n := nodes[dir]
+		sort.Strings(n.children)
+		hashes[dir] = fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(n.children, "\n"))))
+		if !n.unique {
+			byHash[hashes[dir]] = append(byHash[hashes[dir]], n)
+		}
+
+		parent := filepath.Dir(dir)
+		if p, has := nodes[parent]; has && parent != dir {
+			p.children = append(p.children, "dir:"+hashes[dir])
+			p.size += n.size
+			p.unique = p.unique || n.unique
+		}
+	}
+
+	duplicated := make(map[string]bool)
+	for _, members := range byHash {
+		if len(members) > 1 {
+			for _, n := range members {
+				duplicated[n.path] = true
+			}
+		}
+	}
+
+	groups := make([]Group, 0)
+	for sha, members := range byHash {
+		if len(members) < 2 {
+			continue
+		}
+		// the directories inside matching directories match too
+		nested := true
+		for _, n := range members {
+			nested = nested && duplicated[filepath.Dir(n.path)] && filepath.Dir(n.path) != n.path
+		}
+		if nested {
+			continue
+		}
+
+		sort.Slice(members, func(i, j int) bool {
+			return members[i].path < members[j].path
+		})
+		group := Group{Hash: sha, Kept: PathTime{Path: members[0].path, Size: members[0].size}}
+		for _, n := range members[1:] {
+			group.Duplicates = append(group.Duplicates, PathTime{Path: n.path, Size: n.size})
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Hash < groups[j].Hash
+	})
+	return groups
+}
@@ -0,0 +1,113 @@
+package dedup
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EventKind says what an Event reports.
+type EventKind int
+
+const (
+	// FileHashed reports the Hash of File. It is sent as soon as the file
+	// is hashed, so not in walk order.
+	FileHashed EventKind = iota
+	// DuplicateFound reports that File duplicates Kept, the file kept of
+	// the group of Hash so far. A file found later can take Kept's place,
+	// Kept is then reported as a duplicate of it.
+	DuplicateFound
+	// GroupComplete reports that every file of the group of Hash has been
+	// found, Group is what Result.Groups will return for it.
+	GroupComplete
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case FileHashed:
+		return "FileHashed"
+	case DuplicateFound:
+		return "DuplicateFound"
+	case GroupComplete:
+		return "GroupComplete"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is sent to Deduplicator.OnEvent as a scan proceeds. Hash is the key
+// the group is under in Result.Files, which has the scope appended with
+// ScopeDepth, except for FileHashed where it is the file's hash.
+type Event struct {
+	Kind EventKind
+	Hash string
+	// File is the file hashed or found to be a duplicate.
+	File PathTime
+	// Kept is the file File duplicates, for DuplicateFound.
+	Kept PathTime
+	// Group is the complete group, for GroupComplete.
+	Group Group
+}
+
+// event sends e to OnEvent if it is set.
+func (d *Deduplicator) event(e Event) {
+	if d.OnEvent != nil {
+		d.OnEvent(e)
+	}
+}
+
+// groupCompletion sends a GroupComplete event for each group of duplicates
+// in result once every one of the candidates that could be in it has been
+// applied to result. It returns the function to call with each result once
+// it is applied, and the one to call once they all are, which completes the
+// remaining groups such as those of images, which can be of any size.
+func (d *Deduplicator) groupCompletion(result *Result, candidates []fileJob) (func(hashResult), func()) {
+	if d.OnEvent == nil {
+		return func(hashResult) {}, func() {}
+	}
+
+	// only files of the same size can be in the same group, -1 is any size
+	bucket := func(job fileJob) int64 {
+		if d.normalized(job.path) || d.Fingerprint != nil {
+			return -1
+		}
+		return d.hashedSize(job.info.Size())
+	}
+	remaining := make(map[int64]int)
+	for _, job := range candidates {
+		remaining[bucket(job)]++
+	}
+
+	keys := make(map[int64][]string)
+	completed := make(map[string]bool)
+	complete := func(key string) {
+		if completed[key] || len(result.Members[key]) < 2 {
+			return
+		}
+		completed[key] = true
+		d.event(Event{Kind: GroupComplete, Hash: key, Group: result.group(key)})
+	}
+
+	applied := func(h hashResult) {
+		b := bucket(h.fileJob)
+		if h.err == nil {
+			keys[b] = append(keys[b], scopedKey(h.scope, h.sha))
+		}
+		remaining[b]--
+		if remaining[b] == 0 && b >= 0 {
+			for _, key := range keys[b] {
+				complete(key)
+			}
+			delete(keys, b)
+		}
+	}
+	finish := func() {
+		all := make([]string, 0, len(result.Members))
+		for key := range result.Members {
+			all = append(all, key)
+		}
+		sort.Strings(all)
+		for _, key := range all {
+			complete(key)
+		}
+	}
+	return applied, finish
+}
@@ -0,0 +1,29 @@
+package dedup
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// NewHasher returns a new hash.Hash for the algorithm with the given name.
+func NewHasher(name string) (hash.Hash, error) {
+	switch name {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "blake2b":
+		return blake2b.New256(nil)
+	case "xxhash":
+		return xxhash.New(), nil
+	}
+	return nil, fmt.Errorf("unknown hash %q, must be one of sha256, sha1, md5, blake2b or xxhash", name)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isHidden reports whether the file's name starts with a dot.
+func isHidden(path string, info os.FileInfo) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
@@ -0,0 +1,20 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// isHidden reports whether the file's name starts with a dot or it has the
+// hidden attribute set.
+func isHidden(path string, info os.FileInfo) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return true
+	}
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+	}
+	return false
+}
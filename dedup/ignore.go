@@ -0,0 +1,59 @@
+package dedup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the file in an input root listing glob patterns,
+// one per line, of paths to skip. Lines starting with # are comments.
+const IgnoreFile = ".dedupignore"
+
+// readIgnoreFile returns the patterns in the IgnoreFile of root, if it has one.
+func readIgnoreFile(root string) ([]string, error) {
+	filename := filepath.Join(root, IgnoreFile)
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		pattern = filepath.FromSlash(strings.TrimSuffix(pattern, "/"))
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%v:%v: invalid pattern %q: %w", filename, line, pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether rel, a path relative to the root, matches one of
+// the patterns. Patterns without a separator are matched against the base
+// name, the others against the whole relative path.
+func ignored(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.ContainsRune(pattern, filepath.Separator) {
+			name = filepath.Base(rel)
+		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ImageExtensions are the extensions of the files whose pixels are hashed
+// when ImagePixels is set, and that are compared when FindSimilar is set.
+var ImageExtensions = []string{".gif", ".jpeg", ".jpg", ".png"}
+
+// isImage reports whether the file at path is hashed by its pixels.
+func (d *Deduplicator) isImage(path string) bool {
+	return d.ImagePixels && hasImageExtension(path)
+}
+
+// hasImageExtension reports whether path has one of the ImageExtensions.
+func hasImageExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range ImageExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeImage decodes the image in the file at path.
+func (d *Deduplicator) decodeImage(ctx context.Context, path string) (image.Image, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(d.reader(ctx, f))
+	return img, err
+}
+
+// newRow returns a buffer for one row of img, see drawRow.
+func newRow(img image.Image) *image.NRGBA64 {
+	return image.NewNRGBA64(image.Rect(0, 0, img.Bounds().Dx(), 1))
+}
+
+// drawRow draws the y'th row of img into row as 16 bit non-premultiplied
+// RGBA, so images that look the same give the same rows whatever their
+// encoding.
+func drawRow(row *image.NRGBA64, img image.Image, y int) {
+	b := img.Bounds()
+	draw.Draw(row, row.Bounds(), img, image.Pt(b.Min.X, b.Min.Y+y), draw.Src)
+}
+
+// pixelHash returns the hash of the dimensions and decoded pixels of the
+// image of job. Files that can't be decoded are hashed as usual.
+func (d *Deduplicator) pixelHash(ctx context.Context, job fileJob) (string, error) {
+	img, err := d.decodeImage(ctx, job.path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		logrus.Debugf("Found: %v : not a decodable image, hashing bytes: %v", job.path, err)
+		return d.hashFile(ctx, job)
+	}
+
+	h, err := NewHasher(d.hashName())
+	if err != nil {
+		return "", err
+	}
+	size := img.Bounds().Size()
+	binary.Write(h, binary.LittleEndian, int64(size.X))
+	binary.Write(h, binary.LittleEndian, int64(size.Y))
+	row := newRow(img)
+	for y := 0; y < size.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		drawRow(row, img, y)
+		h.Write(row.Pix)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// samePixels reports whether the images a and b have identical dimensions and
+// pixels. If either can't be decoded their bytes are compared instead.
+func (d *Deduplicator) samePixels(ctx context.Context, a string, b string) (bool, error) {
+	imgA, errA := d.decodeImage(ctx, a)
+	imgB, errB := d.decodeImage(ctx, b)
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if errA != nil || errB != nil {
+		return d.sameContent(ctx, a, b)
+	}
+	size := imgA.Bounds().Size()
+	if size != imgB.Bounds().Size() {
+		return false, nil
+	}
+
+	rowA, rowB := newRow(imgA), newRow(imgB)
+	for y := 0; y < size.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		drawRow(rowA, imgA, y)
+		drawRow(rowB, imgB, y)
+		if !bytes.Equal(rowA.Pix, rowB.Pix) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package dedup
+
+import "os"
+
+// fileID is not supported on this platform so hardlinks are not detected.
+func fileID(info os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
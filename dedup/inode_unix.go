@@ -0,0 +1,17 @@
+//go:build unix
+
+package dedup
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of the file described by info.
+func fileID(info os.FileInfo) (inode, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inode{}, false
+	}
+	return inode{uint64(stat.Dev), uint64(stat.Ino)}, true
+}
@@ -0,0 +1,126 @@
+package dedup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeepPolicies lists the names accepted by KeepPolicy.
+var KeepPolicies = []string{"oldest", "newest", "shortest-path", "longest-path", "shortest-name", "first-seen"}
+
+// KeepPolicy returns the comparator for the policy with the given name. The
+// comparator reports whether a should be kept over b.
+//
+// Every policy other than first-seen breaks ties the same way: the older
+// file wins, then the shorter path, then the path that sorts first. first-seen
+// always keeps the file found first in walk order.
+func KeepPolicy(name string) (func(a, b PathTime) bool, error) {
+	return KeepPolicyTolerance(name, 0)
+}
+
+// KeepPolicyTolerance is KeepPolicy with modification times less than
+// tolerance apart treated as equal, for filesystems that store them coarsely.
+// Files whose times are equal this way are kept by the shorter path, then
+// the path that sorts first.
+func KeepPolicyTolerance(name string, tolerance time.Duration) (func(a, b PathTime) bool, error) {
+	breakTie := func(a, b PathTime) bool {
+		return tieBreak(a, b, tolerance)
+	}
+	switch name {
+	case "oldest":
+		return func(a, b PathTime) bool {
+			if !sameTime(a.Time, b.Time, tolerance) {
+				return a.Time.Before(b.Time)
+			}
+			return breakTie(a, b)
+		}, nil
+	case "newest":
+		return func(a, b PathTime) bool {
+			if !sameTime(a.Time, b.Time, tolerance) {
+				return a.Time.After(b.Time)
+			}
+			return breakTie(a, b)
+		}, nil
+	case "shortest-path":
+		return func(a, b PathTime) bool {
+			if len(a.Path) != len(b.Path) {
+				return len(a.Path) < len(b.Path)
+			}
+			return breakTie(a, b)
+		}, nil
+	case "longest-path":
+		return func(a, b PathTime) bool {
+			if len(a.Path) != len(b.Path) {
+				return len(a.Path) > len(b.Path)
+			}
+			return breakTie(a, b)
+		}, nil
+	case "shortest-name":
+		return func(a, b PathTime) bool {
+			nameA, nameB := filepath.Base(a.Path), filepath.Base(b.Path)
+			if len(nameA) != len(nameB) {
+				return len(nameA) < len(nameB)
+			}
+			return breakTie(a, b)
+		}, nil
+	case "first-seen":
+		return func(a, b PathTime) bool {
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown keep policy %q, must be one of %v", name, KeepPolicies)
+}
+
+// preferDir returns a comparator that keeps a file under dir over one that
+// isn't, and otherwise falls back to better.
+func preferDir(dir string, better func(a, b PathTime) bool) (func(a, b PathTime) bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(a, b PathTime) bool {
+		inA, inB := isUnder(a.Path, dir), isUnder(b.Path, dir)
+		if inA != inB {
+			return inA
+		}
+		return better(a, b)
+	}, nil
+}
+
+// isUnder reports whether path is inside the absolute directory dir.
+func isUnder(path string, dir string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// tieBreak prefers the older file, then the shorter path, then the path that
+// sorts first. Times less than tolerance apart are the same.
+func tieBreak(a, b PathTime, tolerance time.Duration) bool {
+	if !sameTime(a.Time, b.Time, tolerance) {
+		return a.Time.Before(b.Time)
+	}
+	if len(a.Path) != len(b.Path) {
+		return len(a.Path) < len(b.Path)
+	}
+	return a.Path < b.Path
+}
+
+// sameTime reports whether a and b are less than tolerance apart, or equal
+// when tolerance is zero.
+func sameTime(a, b time.Time, tolerance time.Duration) bool {
+	diff := a.Sub(b)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff == 0 || diff < tolerance
+}
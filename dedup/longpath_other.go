@@ -0,0 +1,9 @@
+//go:build !windows
+
+package dedup
+
+// LongPath returns path unchanged, only Windows limits the length of paths
+// that aren't in its extended-length form.
+func LongPath(path string) string {
+	return path
+}
@@ -0,0 +1,23 @@
+package dedup
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LongPath returns path in the extended-length form, \\?\C:\dir\file or
+// \\?\UNC\server\share\file, so it can be longer than MAX_PATH. Relative
+// paths are made absolute first.
+func LongPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if unc, ok := strings.CutPrefix(abs, `\\`); ok {
+		return `\\?\UNC\` + unc
+	}
+	return `\\?\` + abs
+}
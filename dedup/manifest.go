@@ -0,0 +1,60 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+)
+
+// ManifestEntry is a file and the hash of its content.
+type ManifestEntry struct {
+	PathTime
+	Hash string
+}
+
+// Manifest hashes every file under root, whether or not it has a duplicate,
+// and returns them in walk order. The same filters as Scan apply. With
+// SkipErrors the files that couldn't be read are returned along with the
+// entries, otherwise the first error stops it.
+func (d *Deduplicator) Manifest(ctx context.Context, root string) ([]ManifestEntry, []FileError, error) {
+	if _, err := NewHasher(d.hashName()); err != nil {
+		return nil, nil, err
+	}
+	if d.BufferSize > MaxBufferSize {
+		return nil, nil, fmt.Errorf("buffer size must be at most %v bytes, got %v", MaxBufferSize, d.BufferSize)
+	}
+	if d.HashOffset < 0 || d.HashLength < 0 {
+		return nil, nil, fmt.Errorf("hash offset and length must not be negative, got %v and %v", d.HashOffset, d.HashLength)
+	}
+
+	result := newResult()
+	found, err := d.walkDirectory(ctx, result, root, nil)
+	if err != nil {
+		return nil, result.Errors, err
+	}
+
+	counts := &counters{}
+	hashed := d.hashFiles(ctx, counts, found, func(ctx context.Context, job fileJob) (string, error) {
+		return d.cachedHashFile(ctx, job, counts)
+	}, nil)
+	if ctx.Err() != nil {
+		return nil, result.Errors, ctx.Err()
+	}
+
+	entries := make([]ManifestEntry, 0, len(hashed))
+	for _, h := range hashed {
+		if h.err == nil && changed(h.fileJob) {
+			h.err = fmt.Errorf("%v changed while it was hashed", h.path)
+		}
+		if h.err != nil {
+			if err := d.fileError(result, h.path, h.err); err != nil {
+				return nil, result.Errors, err
+			}
+			continue
+		}
+		if d.Cache != nil && d.Fingerprint == nil {
+			d.Cache.Put(h.path, h.info, d.cacheName(h.path), h.sha)
+		}
+		entries = append(entries, ManifestEntry{PathTime{h.path, h.info.ModTime(), h.info.Size()}, h.sha})
+	}
+	return entries, result.Errors, nil
+}
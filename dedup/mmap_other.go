@@ -0,0 +1,13 @@
+//go:build !unix
+
+package dedup
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform so files are always streamed.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.ErrUnsupported
+}
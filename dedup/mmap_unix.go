@@ -0,0 +1,20 @@
+//go:build unix
+
+package dedup
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapFile maps the first size bytes of f into memory read only. The
+// returned function unmaps them.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	unix.Madvise(data, unix.MADV_SEQUENTIAL)
+	return data, func() error { return unix.Munmap(data) }, nil
+}
@@ -0,0 +1,100 @@
+package dedup
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// QuickHashSize is the number of bytes read from the start and from the end
+// of a file for its quick fingerprint.
+const QuickHashSize = 64 * 1024
+
+// quickFilter fingerprints the candidates with quickHash. Candidates whose
+// fingerprint is unique are recorded in result.Unique, the others are
+// returned in walk order to be fully hashed.
+func (d *Deduplicator) quickFilter(ctx context.Context, result *Result, candidates []fileJob, counts *counters) ([]fileJob, error) {
+	// the bytes of images hashed by their pixels and of normalized text say
+	// nothing about whether they match, and archive members can't be read
+	// from their end
+	remaining := make([]fileJob, 0, len(candidates))
+	toHash := make([]fileJob, 0, len(candidates))
+	for _, job := range candidates {
+		if d.normalized(job.path) || isArchiveMember(job.info) {
+			remaining = append(remaining, job)
+		} else {
+			toHash = append(toHash, job)
+		}
+	}
+
+	quick := d.hashFiles(ctx, counts, toHash, func(ctx context.Context, job fileJob) (string, error) {
+		counts.bytesRead.Add(min(job.info.Size(), 2*QuickHashSize))
+		return d.quickHash(ctx, job)
+	}, nil)
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+
+	matches := make(map[string]int)
+	for _, h := range quick {
+		if h.err == nil {
+			matches[h.sha]++
+		}
+	}
+
+	for _, h := range quick {
+		if h.err != nil {
+			if err := d.fileError(result, h.path, h.err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if matches[h.sha] == 1 {
+			logrus.Debugf("Found: %v : unique quick hash:%v", h.path, h.sha)
+			result.Unique = append(result.Unique, PathTime{h.path, h.info.ModTime(), h.info.Size()})
+			continue
+		}
+		remaining = append(remaining, h.fileJob)
+	}
+	return remaining, nil
+}
+
+// quickHash returns a fingerprint of the file's size and its first and last
+// QuickHashSize bytes.
+func (d *Deduplicator) quickHash(ctx context.Context, job fileJob) (string, error) {
+	f, err := os.Open(LongPath(job.path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	r := d.reader(ctx, f)
+
+	h, err := NewHasher(d.hashName())
+	if err != nil {
+		return "", err
+	}
+
+	size := job.info.Size()
+	binary.Write(h, binary.LittleEndian, size)
+	if _, err := io.CopyN(h, r, QuickHashSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	if size > 2*QuickHashSize {
+		if _, err := f.Seek(size-QuickHashSize, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(h, r, QuickHashSize); err != nil && err != io.EOF {
+			return "", err
+		}
+	} else if size > QuickHashSize {
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,203 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// similarGroups groups the images among the files left after removing exact
+// duplicates whose perceptual hashes differ in at most SimilarityThreshold
+// bits from the image kept in the group. The images are taken in the order
+// better would keep them, so the files kept are those it prefers. Reference files and
+// files that changed while being hashed are left out, so they are never
+// similar duplicates.
+func (d *Deduplicator) similarGroups(ctx context.Context, result *Result, better func(a, b PathTime) bool, counts *counters) ([]Group, error) {
+	files := result.UniqueFiles()
+
+	jobs := make([]fileJob, 0, len(files))
+	byPath := make(map[string]PathTime)
+	for _, file := range files {
+		if !hasImageExtension(file.Path) || result.ArchiveMembers[file] || result.References[file] || result.Changed[file] {
+			continue
+		}
+		info, err := os.Lstat(LongPath(file.Path))
+		if err != nil {
+			if err := d.fileError(result, file.Path, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		jobs = append(jobs, fileJob{len(jobs), file.Path, info, ""})
+		byPath[file.Path] = file
+	}
+
+	hashed := d.hashFiles(ctx, counts, jobs, func(ctx context.Context, job fileJob) (string, error) {
+		counts.bytesRead.Add(job.info.Size())
+		return d.perceptualHash(ctx, job)
+	}, nil)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	images := make([]PathTime, 0, len(hashed))
+	hashes := make([]uint64, 0, len(hashed))
+	for _, h := range hashed {
+		if h.err != nil {
+			logrus.Debugf("Found: %v : no perceptual hash: %v", h.path, h.err)
+			continue
+		}
+		hash, err := strconv.ParseUint(h.sha, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, byPath[h.path])
+		hashes = append(hashes, hash)
+	}
+
+	// the images are taken in the order they would be kept, each one not yet
+	// grouped keeps the ungrouped images within the threshold of it, so every
+	// image in a group is within the threshold of the one kept
+	order := make([]int, len(images))
+	var tree *bkTree
+	for i := range images {
+		order[i] = i
+		tree = tree.insert(hashes[i], i)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return better(images[order[i]], images[order[j]])
+	})
+
+	grouped := make([]bool, len(images))
+	groups := make([]Group, 0)
+	for _, kept := range order {
+		if grouped[kept] {
+			continue
+		}
+		grouped[kept] = true
+		similar := Group{Hash: fmt.Sprintf("%016x", hashes[kept]), Kept: images[kept]}
+		tree.within(hashes[kept], d.SimilarityThreshold, func(i int) {
+			if !grouped[i] {
+				grouped[i] = true
+				similar.Duplicates = append(similar.Duplicates, images[i])
+			}
+		})
+		if len(similar.Duplicates) == 0 {
+			continue
+		}
+		sort.Slice(similar.Duplicates, func(i, j int) bool {
+			return similar.Duplicates[i].Path < similar.Duplicates[j].Path
+		})
+		groups = append(groups, similar)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Kept.Path < groups[j].Kept.Path
+	})
+	return groups, nil
+}
+
+// bkTree is a BK-tree of perceptual hashes, finding the hashes near another
+// without comparing it with all of them. The children of a node are keyed by
+// their distance from it.
+type bkTree struct {
+	hash     uint64
+	index    int
+	children map[int]*bkTree
+}
+
+// insert adds the hash of the image at index to the tree, returning the tree
+// which is new when t is nil.
+func (t *bkTree) insert(hash uint64, index int) *bkTree {
+	if t == nil {
+		return &bkTree{hash, index, map[int]*bkTree{}}
+	}
+	node := t
+	for {
+		distance := bits.OnesCount64(node.hash ^ hash)
+		child, has := node.children[distance]
+		if !has {
+			node.children[distance] = &bkTree{hash, index, map[int]*bkTree{}}
+			return t
+		}
+		node = child
+	}
+}
+
+// within calls fn with the index of every hash in the tree that differs from
+// hash in at most threshold bits.
+func (t *bkTree) within(hash uint64, threshold int, fn func(index int)) {
+	if t == nil {
+		return
+	}
+	distance := bits.OnesCount64(t.hash ^ hash)
+	if distance <= threshold {
+		fn(t.index)
+	}
+	// by the triangle inequality only these children can hold hashes close
+	// enough
+	for d := max(0, distance-threshold); d <= distance+threshold; d++ {
+		if child, has := t.children[d]; has {
+			child.within(hash, threshold, fn)
+		}
+	}
+}
+
+// perceptualHash returns the difference hash (dHash) of the image in the
+// file: the image is shrunk to 9x8 gray cells and each bit records whether a
+// cell is brighter than its neighbour to the right. Resized or recompressed
+// copies of an image get the same or a very close hash.
+func (d *Deduplicator) perceptualHash(ctx context.Context, job fileJob) (string, error) {
+	img, err := d.decodeImage(ctx, job.path)
+	if err != nil {
+		return "", err
+	}
+
+	var cells [8][9]float64
+	b := img.Bounds()
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			cells[y][x] = cellBrightness(img, image.Rect(
+				b.Min.X+x*b.Dx()/9, b.Min.Y+y*b.Dy()/8,
+				b.Min.X+(x+1)*b.Dx()/9, b.Min.Y+(y+1)*b.Dy()/8,
+			))
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
+
+// cellBrightness returns the average gray level of up to 8x8 pixels sampled
+// evenly from the cell r of img.
+func cellBrightness(img image.Image, r image.Rectangle) float64 {
+	if r.Empty() {
+		return 0
+	}
+	const samples = 8
+	var sum float64
+	var n int
+	for sy := 0; sy < samples && sy < r.Dy(); sy++ {
+		for sx := 0; sx < samples && sx < r.Dx(); sx++ {
+			x := r.Min.X + sx*r.Dx()/min(samples, r.Dx())
+			y := r.Min.Y + sy*r.Dy()/min(samples, r.Dy())
+			sum += float64(color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,124 @@
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// TextExtensions are the extensions of the files whose text is normalized
+// before it is hashed when NormalizeText is set.
+var TextExtensions = []string{
+	".bat", ".c", ".cfg", ".conf", ".cpp", ".cs", ".css", ".csv", ".go", ".h", ".hpp", ".htm", ".html",
+	".ini", ".java", ".js", ".json", ".log", ".md", ".ps1", ".py", ".rb", ".rs", ".rst", ".sh", ".sql",
+	".tex", ".toml", ".ts", ".tsv", ".txt", ".xml", ".yaml", ".yml",
+}
+
+// binarySniffSize is how much of a file is checked for a NUL byte, which
+// marks it as binary whatever its extension, as git does.
+const binarySniffSize = 8000
+
+// isText reports whether the file at path is hashed by its normalized text.
+func (d *Deduplicator) isText(path string) bool {
+	if !d.NormalizeText {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range TextExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// normalized reports whether the file at path is hashed by something other
+// than its bytes, so it can be a duplicate of files of any size.
+func (d *Deduplicator) normalized(path string) bool {
+	return d.isImage(path) || d.isText(path)
+}
+
+// textHash returns the hash of the normalized text of the file of job, see
+// newTextReader.
+func (d *Deduplicator) textHash(ctx context.Context, job fileJob) (string, error) {
+	f, err := openFile(job.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h, err := NewHasher(d.hashName())
+	if err != nil {
+		return "", err
+	}
+	r, err := d.section(ctx, f)
+	if err != nil {
+		return "", err
+	}
+	// text is only a duplicate of text, not of files whose bytes happen
+	// to be normalized
+	io.WriteString(h, "text\x00")
+	if _, err := io.CopyBuffer(h, newTextReader(r), make([]byte, d.bufferSize())); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// textReader reads text with LF line endings, without a UTF-8 byte order
+// mark, whitespace at the end of lines or blank lines at the end, and with a
+// final newline.
+type textReader struct {
+	r *bufio.Reader
+	// out is the normalized text waiting to be read from offset on.
+	out    []byte
+	offset int
+	// blank is the number of blank lines held back until a line that
+	// isn't blank follows.
+	blank int
+	err   error
+}
+
+// newTextReader returns a reader of the normalized text of r, or of r's
+// bytes as they are if it starts with a NUL byte in its first
+// binarySniffSize bytes.
+func newTextReader(r io.Reader) io.Reader {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(binarySniffSize)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return br
+	}
+	if bytes.HasPrefix(head, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	return &textReader{r: br}
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	for t.offset == len(t.out) {
+		if t.err != nil {
+			return 0, t.err
+		}
+		t.out, t.offset = t.out[:0], 0
+
+		line, err := t.r.ReadBytes('\n')
+		t.err = err
+		line = bytes.TrimRight(line, " \t\r\n\v\f")
+		if len(line) == 0 {
+			if err == nil {
+				t.blank++
+			}
+			continue
+		}
+		for ; t.blank > 0; t.blank-- {
+			t.out = append(t.out, '\n')
+		}
+		t.out = append(append(t.out, line...), '\n')
+	}
+	n := copy(p, t.out[t.offset:])
+	t.offset += n
+	return n, nil
+}
@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// walkFollowingSymlinks is like filepath.Walk except symlinks to directories
+// are followed. Each directory is only walked once, so symlink cycles and
+// directories reachable through more than one symlink are only reported the
+// first time.
+func walkFollowingSymlinks(root string, fn filepath.WalkFunc) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return walkFollow(root, real, fn, map[string]bool{})
+}
+
+// walkFollow walks the real directory real, reporting every path as if it
+// were under path.
+func walkFollow(path string, real string, fn filepath.WalkFunc, visited map[string]bool) error {
+	real = LongPath(real)
+	return filepath.WalkDir(real, func(p string, de fs.DirEntry, err error) error {
+		name := path
+		if rel, relErr := filepath.Rel(real, p); relErr == nil && rel != "." {
+			name = filepath.Join(path, rel)
+		}
+		if err != nil {
+			return fn(name, nil, err)
+		}
+
+		if de.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(p)
+			if err != nil {
+				return fn(name, nil, err)
+			}
+			if !info.IsDir() {
+				info, err = de.Info()
+				if err != nil {
+					return fn(name, nil, err)
+				}
+				return fn(name, info, nil)
+			}
+
+			target, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return fn(name, nil, err)
+			}
+			target = LongPath(target)
+			if visited[target] {
+				logrus.Warnf("Skipping %v: %v was already walked, possible symlink cycle", name, target)
+				return nil
+			}
+			return walkFollow(name, target, fn, visited)
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			return fn(name, nil, err)
+		}
+		if info.IsDir() {
+			if visited[p] {
+				logrus.Warnf("Skipping %v: %v was already walked", name, p)
+				return filepath.SkipDir
+			}
+			visited[p] = true
+		}
+		return fn(name, info, nil)
+	})
+}